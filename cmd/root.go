@@ -12,7 +12,8 @@ var rootCmd = &cobra.Command{
 	Long: `Script your CDC events with Javascript. Build complex or simple pre-processing
 pipelines in Javascript.
 
-Javscript files can be hot reloading to avoid downtime.`,
+JavaScript handler files are hot reloaded when they change or on SIGHUP
+to avoid downtime.`,
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
 	// Run: func(cmd *cobra.Command, args []string) {
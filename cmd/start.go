@@ -1,98 +1,660 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"log/slog"
+	"maps"
+	"net/http"
 	"os"
 	"os/signal"
+	"slices"
 	"strings"
+	"sync"
 	"syscall"
+	"time"
 
+	"github.com/JayJamieson/dbscript/pkg/config"
+	"github.com/JayJamieson/dbscript/pkg/javascript"
 	"github.com/JayJamieson/dbscript/pkg/mysql"
+	"github.com/JayJamieson/dbscript/pkg/pipeline"
+	"github.com/JayJamieson/dbscript/pkg/state"
 	"github.com/spf13/cobra"
 	"golang.org/x/term"
 )
 
 var (
-	user     string
-	host     string
-	port     int
-	password string
-	schema   string
-	tables   []string
-	handler  string
+	configFile string
+	user       string
+	host       string
+	port       int
+	password   string
+	schema     string
+	tables     []string
+	handler    string
+	checkpoint string
+	serverID   uint32
+	tlsOptions config.TLS
+	flavor     string
+	heartbeat  time.Duration
+	emitBeats  bool
+	metrics    string
+	maxRetries int
+	batchSize  int
+	batchWait  time.Duration
+	timeout    time.Duration
+	watchEvery time.Duration
+	logLimit   int
+	fetchHosts []string
+	statePath  string
+	disableDB  bool
+	handlerEnv []string
+	secrets    map[string]string
 )
 
 var startCmd = &cobra.Command{
 	Use:   "start",
 	Short: "Start CDC event processing",
-	Long:  `Start processing CDC events from MySQL with JavaScript handlers.`,
+	Long: `Start processing CDC events from MySQL with JavaScript handlers.
+
+A single source can be configured with flags, use --config to tail multiple
+sources from one process. Flags that are not about a source, such as
+--timeout or --state, override the configuration file when set.`,
 	Run: func(cmd *cobra.Command, args []string) {
+		logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+
+		cfg, err := loadConfig(cmd)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
 
-		if password == "" {
-			fmt.Print("Enter password: ")
-			bytePassword, err := term.ReadPassword(int(os.Stdin.Fd()))
+		var store *state.Store
+
+		if cfg.State != "" {
+			store, err = state.Open(cfg.State)
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error reading password: %v\n", err)
+				logger.Error("Error opening state", "error", err)
 				os.Exit(1)
 			}
-			password = string(bytePassword)
-			fmt.Println() // Add newline after password input
-		} else {
-			fmt.Fprintf(os.Stderr, "Warning: Using plain text password from command line is not secure\n")
 		}
 
-		listener, err := mysql.NewBinlogListener(&mysql.BinlogListenerOptions{
-			Host:     host,
-			Port:     port,
-			User:     user,
-			Schema:   schema,
-			Tables:   tables,
-			Password: password,
-		})
+		listeners := make([]*mysql.BinlogListener, 0, len(cfg.Sources))
+		databases := make(map[string]javascript.Database)
+		var pools []*mysql.QueryPool
+
+		for _, source := range cfg.Sources {
+			options := listenerOptions(source)
+
+			if !cfg.DB.Disabled {
+				pool := mysql.NewQueryPool(options, cfg.DB.MaxConns)
+				databases[source.Name] = pool
+				pools = append(pools, pool)
+			}
+
+			if store != nil {
+				// checkpoints are saved with the state written by the source
+				options.Checkpoint = func(flavor string) mysql.CheckpointStore {
+					return store.Checkpoint(source.Name, flavor)
+				}
+			}
+
+			listener, err := mysql.NewBinlogListener(options)
+
+			if err != nil {
+				logger.Error("Error creating BinlogListener", "source", source.Name, "error", err)
+				closeListeners(listeners)
+				closeState(store, logger)
+				os.Exit(1)
+			}
+
+			listener.Logger.Info("Starting CDC processing with:",
+				slog.Group("config", slog.String("schema", source.Schema),
+					slog.String("host", source.Host),
+					slog.Int("port", source.Port),
+					slog.String("user", source.User),
+					slog.Uint64("server_id", uint64(listener.ServerID())),
+					slog.String("flavor", listener.Flavor()),
+					slog.String("tables", strings.Join(source.Tables, ",")),
+					slog.String("handler", cfg.Handler)),
+			)
+
+			listeners = append(listeners, listener)
+		}
+
+		if cfg.MetricsAddr != "" {
+			go func() {
+				// expvar registers /debug/vars on the default mux
+				if err := http.ListenAndServe(cfg.MetricsAddr, nil); err != nil {
+					logger.Error("Error serving metrics", "error", err)
+				}
+			}()
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		tableTimeouts := make(map[string]time.Duration, len(cfg.TableTimeouts))
+		for table, timeout := range cfg.TableTimeouts {
+			tableTimeouts[table] = time.Duration(timeout)
+		}
+
+		defaultSink, sinks, err := newSinks(cfg)
+		if err != nil {
+			logger.Error("Error creating sinks", "error", err)
+			closeListeners(listeners)
+			closeState(store, logger)
+			os.Exit(1)
+		}
+
+		// handlers are checked against the tables known by name
+		var monitored []string
+		for _, source := range cfg.Sources {
+			for _, table := range source.Tables {
+				if !config.IsTablePattern(table) {
+					monitored = append(monitored, source.Schema+"."+table)
+				}
+			}
+		}
+
+		handlerConfig, err := cfg.HandlerConfig.Resolve()
+		if err != nil {
+			logger.Error("Error reading handler config", "error", err)
+			closeListeners(listeners)
+			closeState(store, logger)
+			os.Exit(1)
+		}
+
+		options := javascript.Options{
+			Config:        handlerConfig,
+			Timeout:       time.Duration(cfg.Timeout),
+			TableTimeouts: tableTimeouts,
+			Logger:        logger,
+			LogLimit:      cfg.LogLimit,
+			Fetch: javascript.FetchOptions{
+				AllowedHosts:     cfg.Fetch.AllowedHosts,
+				Timeout:          time.Duration(cfg.Fetch.Timeout),
+				MaxResponseBytes: cfg.Fetch.MaxResponseBytes,
+				Retries:          cfg.Fetch.Retries,
+				RetryDelay:       time.Duration(cfg.Fetch.RetryDelay),
+			},
+			State: store,
+			Sinks: slices.Collect(maps.Keys(sinks)),
+			DB: javascript.DBOptions{
+				Sources:   databases,
+				Timeout:   time.Duration(cfg.DB.Timeout),
+				CacheSize: cfg.DB.CacheSize,
+				CacheTTL:  time.Duration(cfg.DB.CacheTTL),
+			},
+			Lag: func(source string) any {
+				for _, listener := range listeners {
+					if listener.Name() == source {
+						return listener.Lag()
+					}
+				}
+				return nil
+			},
+		}
+
+		handler, scripts, err := newHandler(cfg, options, monitored, logger)
 
 		if err != nil {
-			listener.Logger.Error("Error creating BinlogListener", "error", err)
+			logger.Error("Error loading handler", "error", err)
+			closeListeners(listeners)
+			closeState(store, logger)
 			os.Exit(1)
 		}
 
-		listener.Logger.Info("Starting CDC processing with:",
-			slog.Group("config", slog.String("schema", schema),
-				slog.String("host", host),
-				slog.Int("port", port),
-				slog.String("user", user),
-				slog.String("tables", strings.Join(tables, ",")),
-				slog.String("handler", handler)),
-		)
+		p := pipeline.New(pipeline.Options{
+			Handler:    handler,
+			Sink:       defaultSink,
+			Sinks:      sinks,
+			Logger:     logger,
+			MaxRetries: cfg.MaxRetries,
+			DeadLetter: sinks[cfg.DeadLetterSink],
+
+			BatchSize:   cfg.BatchSize,
+			BatchWindow: time.Duration(cfg.BatchWindow),
+		})
+
+		var wg sync.WaitGroup
+
+		// any source failing stops the whole process so it can be restarted
+		// from the last checkpoint
+		failed := make(chan struct{})
+		var failOnce sync.Once
+		fail := func() {
+			failOnce.Do(func() { close(failed) })
+		}
+
+		for _, listener := range listeners {
+			wg.Add(2)
+
+			go func() {
+				defer wg.Done()
+
+				err := listener.Listen()
+				if ctx.Err() != nil {
+					return
+				}
+
+				// a listener stopping on its own stops the process as well,
+				// so handlers are still shut down
+				if err != nil {
+					listener.Logger.Error("Error starting dbscript", "error", err)
+				} else {
+					listener.Logger.Error("Listener stopped")
+				}
+				fail()
+			}()
+
+			go func() {
+				defer wg.Done()
+				if err := p.Run(ctx, listener); err != nil && ctx.Err() == nil {
+					listener.Logger.Error("Error processing events", "error", err)
+					fail()
+				}
+			}()
+		}
+
+		watchInterval := time.Duration(cfg.WatchInterval)
+		if watchInterval == 0 {
+			watchInterval = javascript.DefaultWatchInterval
+		}
+
+		// watching stops with ctx, before the scripts are shut down
+		if watchInterval > 0 {
+			for _, script := range scripts {
+				wg.Add(1)
+
+				go func() {
+					defer wg.Done()
+					script.Watch(ctx, watchInterval)
+				}()
+			}
+		}
 
 		sig := make(chan os.Signal, 1)
+		hup := make(chan os.Signal, 1)
 
 		signal.Notify(sig, syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGINT)
+		signal.Notify(hup, syscall.SIGHUP)
 
-		go func() {
-			if err := listener.Listen(); err != nil {
-				listener.Logger.Error("Error starting dbscript", "error", err)
+		exitCode := 0
+
+	wait:
+		for {
+			select {
+			case <-hup:
+				for _, script := range scripts {
+					_ = script.Reload()
+				}
+			case <-sig:
+				break wait
+			case <-failed:
+				exitCode = 1
+				break wait
 			}
-		}()
+		}
 
-		<-sig
-		listener.Close()
+		cancel()
+		closeListeners(listeners)
+		wg.Wait()
+
+		// handlers are shared by every source, so they are shut down once
+		// all listeners are closed and their last events are written rather
+		// than when one of them closes. Failures of a source take the same
+		// path, handlers flush what they buffered before exiting with 1.
+		for _, script := range scripts {
+			if err := script.Shutdown(); err != nil {
+				logger.Error("Error shutting down handler", "error", err)
+			}
+		}
+
+		closeState(store, logger)
+
+		for _, pool := range pools {
+			pool.Close()
+		}
+
+		closeSinks(sinks)
+
+		os.Exit(exitCode)
 	},
 }
 
+// newHandler loads the handler, or a chain of stages per table when stages
+// are configured, and returns every script loaded so they can be reloaded.
+// A stage timeout replaces the handler timeout and table timeouts.
+func newHandler(cfg *config.Config, options javascript.Options, tables []string, logger *slog.Logger) (pipeline.Handler, []*javascript.Reloader, error) {
+	var scripts []*javascript.Reloader
+
+	load := func(name string, timeout config.Duration, tables []string) (*javascript.Reloader, error) {
+		options := options
+		options.Name = name
+		options.Tables = tables
+
+		if timeout > 0 {
+			options.Timeout = time.Duration(timeout)
+			options.TableTimeouts = nil
+		}
+
+		js, err := javascript.NewReloader(options, logger)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+
+		scripts = append(scripts, js)
+
+		return js, nil
+	}
+
+	if len(cfg.Stages) == 0 {
+		js, err := load(cfg.Handler, 0, tables)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return js, scripts, nil
+	}
+
+	// tables without their own stages run the "*" stages or the handler
+	var rest []string
+	for _, table := range tables {
+		if _, ok := cfg.Stages[table]; !ok {
+			rest = append(rest, table)
+		}
+	}
+
+	router := &pipeline.TableRouter{Tables: make(map[string]pipeline.Handler, len(cfg.Stages))}
+
+	for table, stages := range cfg.Stages {
+		chainTables := []string{table}
+		if table == "*" {
+			chainTables = rest
+		}
+
+		chain := make([]pipeline.Stage, 0, len(stages))
+
+		for _, stage := range stages {
+			js, err := load(stage.Handler, stage.Timeout, chainTables)
+			if err != nil {
+				return nil, nil, fmt.Errorf("stage %s of %s: %w", stage.Name, table, err)
+			}
+
+			chain = append(chain, pipeline.Stage{
+				Name:    stage.Name,
+				Handler: js,
+				OnError: pipeline.ErrorPolicy(stage.OnError),
+			})
+		}
+
+		if table == "*" {
+			router.Default = pipeline.NewChain(chain...)
+		} else {
+			router.Tables[table] = pipeline.NewChain(chain...)
+		}
+	}
+
+	if router.Default == nil && cfg.Handler != "" {
+		js, err := load(cfg.Handler, 0, rest)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		router.Default = js
+	}
+
+	return router, scripts, nil
+}
+
+// loadConfig reads --config when given, with the flags set on the command
+// line applied on top, otherwise builds a single source from the connection
+// flags.
+func loadConfig(cmd *cobra.Command) (*config.Config, error) {
+	if configFile != "" {
+		cfg, err := config.Load(configFile)
+		if err != nil {
+			return nil, err
+		}
+
+		overrideConfig(cfg, cmd)
+		return cfg, cfg.Validate()
+	}
+
+	source, err := sourceFromFlags()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &config.Config{
+		Handler:     handler,
+		MetricsAddr: metrics,
+		MaxRetries:  maxRetries,
+		BatchSize:   batchSize,
+		BatchWindow: config.Duration(batchWait),
+		LogLimit:    logLimit,
+		Fetch:       config.Fetch{AllowedHosts: fetchHosts},
+		DB:          config.DB{Disabled: disableDB},
+		State:       statePath,
+		Timeout:     config.Duration(timeout),
+		Sources:     []config.Source{source},
+
+		HandlerConfig: config.HandlerConfig{Env: handlerEnv, Secrets: secrets},
+		WatchInterval: config.Duration(watchEvery),
+	}
+
+	return cfg, cfg.Validate()
+}
+
+// overrideConfig sets the settings of cfg whose flags were given explicitly,
+// the flags describing a source are mutually exclusive with --config.
+func overrideConfig(cfg *config.Config, cmd *cobra.Command) {
+	changed := cmd.Flags().Changed
+
+	if changed("metrics-addr") {
+		cfg.MetricsAddr = metrics
+	}
+	if changed("timeout") {
+		cfg.Timeout = config.Duration(timeout)
+	}
+	if changed("watch-interval") {
+		cfg.WatchInterval = config.Duration(watchEvery)
+	}
+	if changed("log-limit") {
+		cfg.LogLimit = logLimit
+	}
+	if changed("fetch-allow") {
+		cfg.Fetch.AllowedHosts = fetchHosts
+	}
+	if changed("max-retries") {
+		cfg.MaxRetries = maxRetries
+	}
+	if changed("batch-size") {
+		cfg.BatchSize = batchSize
+	}
+	if changed("batch-window") {
+		cfg.BatchWindow = config.Duration(batchWait)
+	}
+	if changed("handler-env") {
+		cfg.HandlerConfig.Env = handlerEnv
+	}
+	if changed("handler-secret") {
+		cfg.HandlerConfig.Secrets = secrets
+	}
+	if changed("disable-db") {
+		cfg.DB.Disabled = disableDB
+	}
+	if changed("state") {
+		cfg.State = statePath
+	}
+}
+
+// sourceFromFlags builds the "default" source from the connection flags,
+// prompting for the password when it is not given.
+func sourceFromFlags() (config.Source, error) {
+	if password == "" {
+		fmt.Print("Enter password: ")
+		bytePassword, err := term.ReadPassword(int(os.Stdin.Fd()))
+		if err != nil {
+			return config.Source{}, fmt.Errorf("reading password: %w", err)
+		}
+		password = string(bytePassword)
+		fmt.Println() // Add newline after password input
+	} else {
+		fmt.Fprintf(os.Stderr, "Warning: Using plain text password from command line is not secure\n")
+	}
+
+	return config.Source{
+		Name:     "default",
+		Host:     host,
+		Port:     port,
+		User:     user,
+		Password: password,
+		Schema:   schema,
+		Tables:   tables,
+		ServerID: serverID,
+		TLS:      tlsOptions,
+		Flavor:   flavor,
+
+		HeartbeatPeriod: config.Duration(heartbeat),
+		EmitHeartbeats:  emitBeats,
+		Checkpoint:      checkpoint,
+	}, nil
+}
+
+func listenerOptions(source config.Source) *mysql.BinlogListenerOptions {
+	return &mysql.BinlogListenerOptions{
+		Name:            source.Name,
+		Host:            source.Host,
+		Port:            source.Port,
+		User:            source.User,
+		Schema:          source.Schema,
+		Tables:          source.Tables,
+		Password:        source.Password,
+		ServerID:        source.ServerID,
+		CheckpointFile:  source.Checkpoint,
+		Flavor:          source.Flavor,
+		HeartbeatPeriod: time.Duration(source.HeartbeatPeriod),
+		EmitHeartbeats:  source.EmitHeartbeats,
+		TLS: mysql.TLSOptions{
+			Enabled:            source.TLS.Enabled,
+			CAFile:             source.TLS.CAFile,
+			CertFile:           source.TLS.CertFile,
+			KeyFile:            source.TLS.KeyFile,
+			ServerName:         source.TLS.ServerName,
+			InsecureSkipVerify: source.TLS.InsecureSkipVerify,
+		},
+	}
+}
+
+// newSinks creates the named sinks of the configuration and returns the
+// default sink, stdout unless default_sink names one of them.
+func newSinks(cfg *config.Config) (pipeline.Sink, map[string]pipeline.Sink, error) {
+	sinks := make(map[string]pipeline.Sink, len(cfg.Sinks))
+
+	for name, sinkConfig := range cfg.Sinks {
+		switch sinkConfig.Type {
+		case config.SinkStdout:
+			sinks[name] = pipeline.NewWriterSink(os.Stdout)
+		case config.SinkFile:
+			sink, err := pipeline.NewFileSink(sinkConfig.Path)
+			if err != nil {
+				closeSinks(sinks)
+				return nil, nil, err
+			}
+			sinks[name] = sink
+		case config.SinkWebhook:
+			sinks[name] = pipeline.NewWebhookSink(sinkConfig.URL, sinkConfig.Headers, time.Duration(sinkConfig.Timeout))
+		}
+	}
+
+	if cfg.DefaultSink != "" {
+		return sinks[cfg.DefaultSink], sinks, nil
+	}
+
+	return pipeline.NewWriterSink(os.Stdout), sinks, nil
+}
+
+func closeSinks(sinks map[string]pipeline.Sink) {
+	for _, sink := range sinks {
+		if closer, ok := sink.(io.Closer); ok {
+			closer.Close()
+		}
+	}
+}
+
+func closeListeners(listeners []*mysql.BinlogListener) {
+	for _, listener := range listeners {
+		listener.Close()
+	}
+}
+
+// closeState closes the state store, os.Exit skips deferred calls.
+func closeState(store *state.Store, logger *slog.Logger) {
+	if store == nil {
+		return
+	}
+
+	// no checkpoint is saved after shutdown hooks, their writes are
+	// persisted on their own
+	if err := store.Flush(); err != nil {
+		logger.Error("Error persisting state", "error", err)
+	}
+
+	store.Close()
+}
+
 func init() {
 	rootCmd.AddCommand(startCmd)
 
-	startCmd.Flags().StringVarP(&user, "user", "u", "", "Database user")
-	startCmd.Flags().StringVarP(&host, "host", "H", "localhost", "Database host")
-	startCmd.Flags().IntVarP(&port, "port", "p", 3306, "Database port")
-	startCmd.Flags().StringVar(&password, "password", "", "Database password (leave empty to prompt)")
-	startCmd.Flags().StringVar(&schema, "schema", "", "Database schema name")
-	startCmd.Flags().StringSliceVar(&tables, "tables", []string{}, "Tables to monitor for changes")
-	startCmd.Flags().StringVar(&handler, "handler", "", "JavaScript handler file")
-
-	startCmd.MarkFlagRequired("user")
-	startCmd.MarkFlagRequired("schema")
-	startCmd.MarkFlagRequired("tables")
-	startCmd.MarkFlagRequired("handler")
+	addConnectionFlags(startCmd)
+
+	startCmd.Flags().StringVar(&handler, "handler", "", "JavaScript or TypeScript handler file")
+	startCmd.Flags().Uint32Var(&serverID, "server-id", 0, "Unique replication server ID (derived from hostname when not set)")
+	startCmd.Flags().StringVar(&flavor, "flavor", mysql.FlavorAuto, "Server flavor: mysql, mariadb or auto to detect it")
+	startCmd.Flags().DurationVar(&heartbeat, "heartbeat-period", 10*time.Second, "Replication heartbeat and lag measurement interval")
+	startCmd.Flags().BoolVar(&emitBeats, "emit-heartbeats", false, "Emit HEARTBEAT events when no rows changed during a heartbeat period")
+	startCmd.Flags().StringVar(&metrics, "metrics-addr", "", "Address to serve expvar metrics on /debug/vars")
+	startCmd.Flags().DurationVar(&timeout, "timeout", config.DefaultTimeout, "Handler execution timeout per event, 0 disables it")
+	startCmd.Flags().DurationVar(&watchEvery, "watch-interval", javascript.DefaultWatchInterval, "How often handler files are checked for changes, negative disables watching")
+	startCmd.Flags().IntVar(&logLimit, "log-limit", javascript.DefaultLogLimit, "Messages a handler may log per event, negative disables the limit")
+	startCmd.Flags().StringSliceVar(&fetchHosts, "fetch-allow", []string{}, "Hosts handlers may fetch from, *.domain matches subdomains")
+	startCmd.Flags().IntVar(&maxRetries, "max-retries", config.DefaultMaxRetries, "Retries for errored events before they are dead lettered or dropped, 0 disables retries")
+	startCmd.Flags().IntVar(&batchSize, "batch-size", 0, "Events passed to handleBatch at most, batching is off below 2")
+	startCmd.Flags().DurationVar(&batchWait, "batch-window", pipeline.DefaultBatchWindow, "How long events are collected for handleBatch")
+	startCmd.Flags().StringSliceVar(&handlerEnv, "handler-env", []string{}, "Environment variables exposed to handlers in dbscript.config")
+	startCmd.Flags().StringToStringVar(&secrets, "handler-secret", map[string]string{}, "Secret files exposed to handlers in dbscript.config as key=path")
+	startCmd.Flags().StringVar(&checkpoint, "checkpoint", "", "File to persist the binlog position to")
+	startCmd.Flags().BoolVar(&disableDB, "disable-db", false, "Disable dbscript.db queries against the sources")
+	startCmd.Flags().StringVar(&statePath, "state", "", "File to persist handler state and the binlog position to")
+
+	for _, name := range []string{"handler", "server-id", "flavor", "heartbeat-period", "emit-heartbeats", "checkpoint"} {
+		startCmd.MarkFlagsMutuallyExclusive("config", name)
+	}
+	startCmd.MarkFlagsMutuallyExclusive("checkpoint", "state")
+}
+
+// addConnectionFlags registers the flags describing a single source shared
+// by every command connecting to MySQL.
+func addConnectionFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&configFile, "config", "c", "", "Configuration file, replaces the flags describing a source")
+	cmd.Flags().StringVarP(&user, "user", "u", "", "Database user")
+	cmd.Flags().StringVarP(&host, "host", "H", "localhost", "Database host")
+	cmd.Flags().IntVarP(&port, "port", "p", 3306, "Database port")
+	cmd.Flags().StringVar(&password, "password", "", "Database password (leave empty to prompt)")
+	cmd.Flags().StringVar(&schema, "schema", "", "Database schema name")
+	cmd.Flags().StringSliceVar(&tables, "tables", []string{}, "Tables to monitor for changes")
+	cmd.Flags().BoolVar(&tlsOptions.Enabled, "tls", false, "Connect using TLS")
+	cmd.Flags().StringVar(&tlsOptions.CAFile, "tls-ca", "", "PEM CA bundle to verify the server certificate")
+	cmd.Flags().StringVar(&tlsOptions.CertFile, "tls-cert", "", "PEM client certificate")
+	cmd.Flags().StringVar(&tlsOptions.KeyFile, "tls-key", "", "PEM client certificate key")
+	cmd.Flags().StringVar(&tlsOptions.ServerName, "tls-server-name", "", "Server name to verify the certificate against (defaults to --host)")
+	cmd.Flags().BoolVar(&tlsOptions.InsecureSkipVerify, "tls-skip-verify", false, "Skip server certificate verification (development only)")
+
+	for _, name := range []string{"user", "host", "port", "password", "schema", "tables", "tls", "tls-ca", "tls-cert", "tls-key", "tls-server-name", "tls-skip-verify"} {
+		cmd.MarkFlagsMutuallyExclusive("config", name)
+	}
+	cmd.MarkFlagsRequiredTogether("tls-cert", "tls-key")
 }
@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/JayJamieson/dbscript/pkg/config"
+	"github.com/JayJamieson/dbscript/pkg/javascript"
+	"github.com/JayJamieson/dbscript/pkg/mysql"
+	"github.com/spf13/cobra"
+)
+
+var typesOutput string
+
+var typesCmd = &cobra.Command{
+	Use:   "types",
+	Short: "Generate TypeScript definitions for handlers",
+	Long: `Generate a TypeScript declaration file describing the dbscript global and
+the row changes of the monitored tables, read from the column metadata of
+every source.
+
+Reference the file from handlers or tsconfig.json for editor completion.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		sources, err := loadSources()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		var tables []mysql.TableSchema
+		seen := make(map[string]bool)
+
+		for _, source := range sources {
+			described, err := mysql.DescribeTables(listenerOptions(source))
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: source %s: %v\n", source.Name, err)
+				os.Exit(1)
+			}
+
+			// shards usually share a schema, describe each table once
+			for _, table := range described {
+				key := table.Database + "." + table.Table
+				if !seen[key] {
+					seen[key] = true
+					tables = append(tables, table)
+				}
+			}
+		}
+
+		out, err := os.Create(typesOutput)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		if err := javascript.WriteDefinitions(out, tables); err != nil {
+			out.Close()
+			fmt.Fprintf(os.Stderr, "Error: writing %s: %v\n", typesOutput, err)
+			os.Exit(1)
+		}
+
+		if err := out.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: writing %s: %v\n", typesOutput, err)
+			os.Exit(1)
+		}
+
+		fmt.Fprintf(os.Stderr, "Wrote %d tables to %s\n", len(tables), typesOutput)
+	},
+}
+
+// loadSources returns the sources of --config or the one described by the
+// connection flags.
+func loadSources() ([]config.Source, error) {
+	if configFile != "" {
+		cfg, err := config.Load(configFile)
+		if err != nil {
+			return nil, err
+		}
+		return cfg.Sources, nil
+	}
+
+	source, err := sourceFromFlags()
+	if err != nil {
+		return nil, err
+	}
+
+	return []config.Source{source}, source.Validate()
+}
+
+func init() {
+	rootCmd.AddCommand(typesCmd)
+
+	addConnectionFlags(typesCmd)
+
+	typesCmd.Flags().StringVarP(&typesOutput, "output", "o", "dbscript.d.ts", "Declaration file to write")
+}
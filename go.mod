@@ -3,9 +3,12 @@ module github.com/JayJamieson/dbscript
 go 1.24.1
 
 require (
+	github.com/evanw/esbuild v0.28.2
 	github.com/go-mysql-org/go-mysql v1.12.0
+	github.com/google/uuid v1.6.0
 	github.com/grafana/sobek v0.0.0-20250617123252-8dce75eadcb6
 	github.com/spf13/cobra v1.9.1
+	go.etcd.io/bbolt v1.4.3
 	golang.org/x/term v0.33.0
 )
 
@@ -17,7 +20,6 @@ require (
 	github.com/go-sourcemap/sourcemap v2.1.3+incompatible // indirect
 	github.com/goccy/go-json v0.10.2 // indirect
 	github.com/google/pprof v0.0.0-20230207041349-798e818bf904 // indirect
-	github.com/google/uuid v1.3.0 // indirect
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
 	github.com/klauspost/compress v1.17.8 // indirect
 	github.com/pingcap/errors v0.11.5-0.20240311024730-e056997136bb // indirect
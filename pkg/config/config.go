@@ -0,0 +1,428 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout is the execution budget of a handler invocation when the
+// configuration does not set timeout.
+const DefaultTimeout = 5 * time.Second
+
+// DefaultMaxRetries is how many times an errored event is retried when the
+// configuration does not set max_retries.
+const DefaultMaxRetries = 3
+
+// Config describes a dbscript process. A single process can tail several
+// sources and feed every event into the same handler and sink set.
+type Config struct {
+	Sources []Source `json:"sources"`
+	Handler string   `json:"handler"`
+
+	// HandlerConfig is passed to init and exposed as dbscript.config.
+	HandlerConfig HandlerConfig `json:"handler_config"`
+
+	// Stages chains handler scripts per table keyed by "database.table",
+	// "*" is used for tables without their own stages. Tables without
+	// stages run Handler, which is only required when stages do not cover
+	// every table.
+	Stages map[string][]Stage `json:"stages"`
+
+	// Timeout is the execution budget of a handler invocation,
+	// DefaultTimeout when not set. "0s" disables it.
+	Timeout Duration `json:"timeout"`
+
+	// TableTimeouts overrides Timeout per table keyed by "database.table".
+	TableTimeouts map[string]Duration `json:"table_timeouts"`
+
+	// MaxRetries is how many times an errored event is retried before it is
+	// dead lettered or dropped, DefaultMaxRetries when not set. Zero
+	// disables retries.
+	MaxRetries int `json:"max_retries"`
+
+	// BatchSize is how many events handleBatch receives at most, collected
+	// for up to BatchWindow. Batching is off below 2.
+	BatchSize   int      `json:"batch_size"`
+	BatchWindow Duration `json:"batch_window"`
+
+	// WatchInterval is how often handler files are checked for changes and
+	// reloaded, zero uses the default and negative disables watching.
+	WatchInterval Duration `json:"watch_interval"`
+
+	// LogLimit caps the messages a handler logs per event, zero uses the
+	// default and negative disables the limit.
+	LogLimit int `json:"log_limit"`
+
+	// Fetch configures the fetch API available to handlers.
+	Fetch Fetch `json:"fetch"`
+
+	// Sinks are named destinations handlers route events to with
+	// dbscript.ctx.ok(event, name).
+	Sinks map[string]Sink `json:"sinks"`
+
+	// DefaultSink receives the events not routed to a named sink, stdout
+	// when empty.
+	DefaultSink string `json:"default_sink"`
+
+	// DeadLetterSink receives the events still erroring after MaxRetries,
+	// they are dropped when empty.
+	DeadLetterSink string `json:"dead_letter_sink"`
+
+	// DB configures dbscript.db lookups against the sources.
+	DB DB `json:"db"`
+
+	// State is the database file backing dbscript.state. Checkpoints of
+	// every source are stored in it as well, so sources must not set
+	// checkpoint.
+	State string `json:"state"`
+
+	// MetricsAddr serves expvar metrics on /debug/vars when set.
+	MetricsAddr string `json:"metrics_addr"`
+}
+
+// Source is a single named MySQL server to replicate from.
+type Source struct {
+	Name     string   `json:"name"`
+	Host     string   `json:"host"`
+	Port     int      `json:"port"`
+	User     string   `json:"user"`
+	Password string   `json:"password"`
+	Schema   string   `json:"schema"`
+	Tables   []string `json:"tables"`
+	ServerID uint32   `json:"server_id"`
+	TLS      TLS      `json:"tls"`
+
+	// Flavor is mysql, mariadb or auto to detect it from the server version.
+	Flavor string `json:"flavor"`
+
+	HeartbeatPeriod Duration `json:"heartbeat_period"`
+	EmitHeartbeats  bool     `json:"emit_heartbeats"`
+
+	// Checkpoint is the file the source binlog position is persisted to so
+	// processing can resume after a restart.
+	Checkpoint string `json:"checkpoint"`
+}
+
+// IsTablePattern reports whether a table of a source is a regular expression
+// rather than a table name. The tables it matches are not known before their
+// events arrive, so handlers and stages are not checked against them.
+func IsTablePattern(table string) bool {
+	return strings.ContainsAny(table, `.*+?()[]{}|^$\`)
+}
+
+// Stage error policies.
+const (
+	OnErrorRetry = "retry"
+	OnErrorDrop  = "drop"
+	OnErrorSkip  = "skip"
+)
+
+// Stage is one handler script of a chain.
+type Stage struct {
+	// Name identifies the stage in errors and logs, the handler file when
+	// empty.
+	Name    string `json:"name"`
+	Handler string `json:"handler"`
+
+	// Timeout overrides the execution budget of the stage.
+	Timeout Duration `json:"timeout"`
+
+	// OnError is retry, the default, to retry the event from the stage that
+	// errored, drop to drop it or skip to pass it on to the next stage.
+	OnError string `json:"on_error"`
+}
+
+// Validate checks the stage of table at index i.
+func (s Stage) Validate(table string, i int) error {
+	if s.Handler == "" {
+		return fmt.Errorf("stages %s[%d]: handler is required", table, i)
+	}
+
+	switch s.OnError {
+	case "", OnErrorRetry, OnErrorDrop, OnErrorSkip:
+	default:
+		return fmt.Errorf("stages %s[%d]: unknown on_error %q, expected retry, drop or skip", table, i, s.OnError)
+	}
+
+	return nil
+}
+
+// HandlerConfig is the configuration handlers receive, built from values,
+// environment variables and secret files.
+type HandlerConfig struct {
+	// Values are JSON values passed as they are.
+	Values map[string]any `json:"values"`
+
+	// Env are the names of the environment variables handlers may read,
+	// unset variables are left out.
+	Env []string `json:"env"`
+
+	// Secrets maps keys to files whose content is passed without trailing
+	// newlines.
+	Secrets map[string]string `json:"secrets"`
+}
+
+// Resolve reads the environment variables and secret files into a single
+// map, keys must be unique across values, env and secrets.
+func (h HandlerConfig) Resolve() (map[string]any, error) {
+	resolved := make(map[string]any, len(h.Values)+len(h.Env)+len(h.Secrets))
+
+	for key, value := range h.Values {
+		resolved[key] = value
+	}
+
+	for _, name := range h.Env {
+		if _, ok := resolved[name]; ok {
+			return nil, fmt.Errorf("handler_config: env %s is already defined", name)
+		}
+
+		if value, ok := os.LookupEnv(name); ok {
+			resolved[name] = value
+		}
+	}
+
+	for key, path := range h.Secrets {
+		if _, ok := resolved[key]; ok {
+			return nil, fmt.Errorf("handler_config: secret %s is already defined", key)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("handler_config: reading secret %s: %w", key, err)
+		}
+
+		resolved[key] = strings.TrimRight(string(data), "\r\n")
+	}
+
+	return resolved, nil
+}
+
+// Fetch limits the HTTP requests handlers can make.
+type Fetch struct {
+	// AllowedHosts are host names or *.domain wildcards, fetch is disabled
+	// when empty.
+	AllowedHosts     []string `json:"allowed_hosts"`
+	Timeout          Duration `json:"timeout"`
+	MaxResponseBytes int64    `json:"max_response_bytes"`
+	Retries          int      `json:"retries"`
+	RetryDelay       Duration `json:"retry_delay"`
+}
+
+// Sink types.
+const (
+	SinkStdout  = "stdout"
+	SinkFile    = "file"
+	SinkWebhook = "webhook"
+)
+
+// Sink is a destination for processed events.
+type Sink struct {
+	// Type is stdout, file or webhook.
+	Type string `json:"type"`
+
+	// Path is the file events are appended to as JSON lines.
+	Path string `json:"path"`
+
+	// URL receives a POST request with a JSON array of events per write.
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+	Timeout Duration          `json:"timeout"`
+}
+
+// Validate checks that the sink has everything its type needs.
+func (s Sink) Validate(name string) error {
+	switch s.Type {
+	case SinkStdout:
+	case SinkFile:
+		if s.Path == "" {
+			return fmt.Errorf("sink %s: path is required", name)
+		}
+	case SinkWebhook:
+		if s.URL == "" {
+			return fmt.Errorf("sink %s: url is required", name)
+		}
+	default:
+		return fmt.Errorf("sink %s: unknown type %q, expected stdout, file or webhook", name, s.Type)
+	}
+
+	return nil
+}
+
+// DB configures the read-only queries handlers run against sources over
+// connections separate from replication.
+type DB struct {
+	// Disabled turns dbscript.db off, it is enabled by default.
+	Disabled bool     `json:"disabled"`
+	MaxConns int      `json:"max_conns"`
+	Timeout  Duration `json:"timeout"`
+
+	// CacheSize is how many query results are cached, negative disables the
+	// cache.
+	CacheSize int      `json:"cache_size"`
+	CacheTTL  Duration `json:"cache_ttl"`
+}
+
+// TLS configures encrypted connections to a source.
+type TLS struct {
+	Enabled            bool   `json:"enabled"`
+	CAFile             string `json:"ca_file"`
+	CertFile           string `json:"cert_file"`
+	KeyFile            string `json:"key_file"`
+	ServerName         string `json:"server_name"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify"`
+}
+
+// Duration is a time.Duration written as a string such as "10s" in JSON.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"10s\": %w", err)
+	}
+
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Load reads and validates a JSON configuration file.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// zero is a valid timeout and retry count, the defaults are only kept
+	// when they are not set
+	cfg := &Config{Timeout: Duration(DefaultTimeout), MaxRetries: DefaultMaxRetries}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("parsing config %s: %w", path, err)
+	}
+
+	cfg.setDefaults()
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+
+	return cfg, nil
+}
+
+func (c *Config) setDefaults() {
+	for i := range c.Sources {
+		if c.Sources[i].Host == "" {
+			c.Sources[i].Host = "localhost"
+		}
+		if c.Sources[i].Port == 0 {
+			c.Sources[i].Port = 3306
+		}
+	}
+
+	for _, stages := range c.Stages {
+		for i := range stages {
+			if stages[i].Name == "" {
+				stages[i].Name = stages[i].Handler
+			}
+		}
+	}
+}
+
+// Validate checks that every source is usable and uniquely named.
+func (c *Config) Validate() error {
+	if len(c.Sources) == 0 {
+		return fmt.Errorf("at least one source is required")
+	}
+
+	if c.Handler == "" && len(c.Stages) == 0 {
+		return fmt.Errorf("handler or stages is required")
+	}
+
+	for table, stages := range c.Stages {
+		if len(stages) == 0 {
+			return fmt.Errorf("stages %s: at least one stage is required", table)
+		}
+
+		for i, stage := range stages {
+			if err := stage.Validate(table, i); err != nil {
+				return err
+			}
+		}
+	}
+
+	names := make(map[string]bool)
+	for i, source := range c.Sources {
+		if source.Name == "" {
+			return fmt.Errorf("sources[%d]: name is required", i)
+		}
+		if names[source.Name] {
+			return fmt.Errorf("sources[%d]: duplicate source name %q", i, source.Name)
+		}
+		names[source.Name] = true
+
+		if err := source.Validate(); err != nil {
+			return err
+		}
+
+		if c.State != "" && source.Checkpoint != "" {
+			return fmt.Errorf("source %s: checkpoint cannot be set with state, checkpoints are stored in the state file", source.Name)
+		}
+
+		if _, ok := c.Stages["*"]; c.Handler == "" && !ok {
+			for _, table := range source.Tables {
+				if IsTablePattern(table) {
+					return fmt.Errorf("source %s: tables matching %s.%s need \"*\" stages or a handler", source.Name, source.Schema, table)
+				}
+
+				if _, ok := c.Stages[source.Schema+"."+table]; !ok {
+					return fmt.Errorf("source %s: table %s.%s has no stages and no handler is set", source.Name, source.Schema, table)
+				}
+			}
+		}
+	}
+
+	for name, sink := range c.Sinks {
+		if err := sink.Validate(name); err != nil {
+			return err
+		}
+	}
+
+	if _, ok := c.Sinks[c.DefaultSink]; c.DefaultSink != "" && !ok {
+		return fmt.Errorf("default_sink %q is not defined in sinks", c.DefaultSink)
+	}
+
+	if _, ok := c.Sinks[c.DeadLetterSink]; c.DeadLetterSink != "" && !ok {
+		return fmt.Errorf("dead_letter_sink %q is not defined in sinks", c.DeadLetterSink)
+	}
+
+	return nil
+}
+
+// Validate checks that the source has everything needed to connect.
+func (s Source) Validate() error {
+	if s.User == "" {
+		return fmt.Errorf("source %s: user is required", s.Name)
+	}
+	if s.Schema == "" {
+		return fmt.Errorf("source %s: schema is required", s.Name)
+	}
+	if len(s.Tables) == 0 {
+		return fmt.Errorf("source %s: tables is required", s.Name)
+	}
+	if (s.TLS.CertFile == "") != (s.TLS.KeyFile == "") {
+		return fmt.Errorf("source %s: tls cert_file and key_file must be set together", s.Name)
+	}
+
+	return nil
+}
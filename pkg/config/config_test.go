@@ -0,0 +1,285 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "dbscript.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	path := writeConfig(t, `{
+		"handler": "handler.js",
+		"sources": [
+			{"name": "shard1", "host": "db1", "user": "dbscript", "schema": "app", "tables": ["user"], "server_id": 2001, "checkpoint": "shard1.pos", "heartbeat_period": "5s"},
+			{"name": "shard2", "host": "db2", "port": 3307, "user": "dbscript", "schema": "app", "tables": ["user", "events"]}
+		]
+	}`)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if len(cfg.Sources) != 2 {
+		t.Fatalf("len(Sources) = %d, expected 2", len(cfg.Sources))
+	}
+
+	if cfg.Sources[0].Port != 3306 {
+		t.Errorf("Sources[0].Port = %d, expected default 3306", cfg.Sources[0].Port)
+	}
+
+	if cfg.Sources[0].ServerID != 2001 {
+		t.Errorf("Sources[0].ServerID = %d, expected 2001", cfg.Sources[0].ServerID)
+	}
+
+	if time.Duration(cfg.Sources[0].HeartbeatPeriod) != 5*time.Second {
+		t.Errorf("Sources[0].HeartbeatPeriod = %v, expected 5s", time.Duration(cfg.Sources[0].HeartbeatPeriod))
+	}
+
+	if cfg.Sources[1].Port != 3307 {
+		t.Errorf("Sources[1].Port = %d, expected 3307", cfg.Sources[1].Port)
+	}
+
+	if time.Duration(cfg.Timeout) != DefaultTimeout {
+		t.Errorf("Timeout = %v, expected default %v", time.Duration(cfg.Timeout), DefaultTimeout)
+	}
+
+	if cfg.MaxRetries != DefaultMaxRetries {
+		t.Errorf("MaxRetries = %d, expected default %d", cfg.MaxRetries, DefaultMaxRetries)
+	}
+}
+
+func TestLoadMaxRetriesZero(t *testing.T) {
+	path := writeConfig(t, `{
+		"handler": "handler.js",
+		"max_retries": 0,
+		"sources": [{"name": "default", "user": "dbscript", "schema": "app", "tables": ["user"]}]
+	}`)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if cfg.MaxRetries != 0 {
+		t.Errorf("MaxRetries = %d, expected 0", cfg.MaxRetries)
+	}
+}
+
+func TestLoadTimeout(t *testing.T) {
+	tests := []struct {
+		timeout  string
+		expected time.Duration
+	}{
+		{timeout: `"2s"`, expected: 2 * time.Second},
+		{timeout: `"0s"`, expected: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.timeout, func(t *testing.T) {
+			path := writeConfig(t, `{
+				"handler": "handler.js",
+				"timeout": `+tt.timeout+`,
+				"sources": [{"name": "default", "user": "dbscript", "schema": "app", "tables": ["user"]}]
+			}`)
+
+			cfg, err := Load(path)
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+
+			if time.Duration(cfg.Timeout) != tt.expected {
+				t.Errorf("Timeout = %v, expected %v", time.Duration(cfg.Timeout), tt.expected)
+			}
+		})
+	}
+}
+
+func TestLoadStages(t *testing.T) {
+	path := writeConfig(t, `{
+		"stages": {
+			"app.user": [
+				{"name": "filter", "handler": "filter.js", "timeout": "100ms"},
+				{"handler": "enrich.js", "on_error": "skip"}
+			],
+			"*": [{"handler": "route.js"}]
+		},
+		"sources": [{"name": "a", "user": "dbscript", "schema": "app", "tables": ["user", "events", "log_.*"]}]
+	}`)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	stages := cfg.Stages["app.user"]
+	if len(stages) != 2 {
+		t.Fatalf("len(Stages[app.user]) = %d, expected 2", len(stages))
+	}
+
+	if time.Duration(stages[0].Timeout) != 100*time.Millisecond {
+		t.Errorf("Stages[app.user][0].Timeout = %v, expected 100ms", time.Duration(stages[0].Timeout))
+	}
+
+	if stages[1].Name != "enrich.js" {
+		t.Errorf("Stages[app.user][1].Name = %q, expected %q", stages[1].Name, "enrich.js")
+	}
+
+	if stages[1].OnError != OnErrorSkip {
+		t.Errorf("Stages[app.user][1].OnError = %q, expected %q", stages[1].OnError, OnErrorSkip)
+	}
+}
+
+func TestIsTablePattern(t *testing.T) {
+	tests := []struct {
+		table    string
+		expected bool
+	}{
+		{table: "user", expected: false},
+		{table: "user_events", expected: false},
+		{table: "user_.*", expected: true},
+		{table: "(a|b)", expected: true},
+		{table: "log[0-9]+", expected: true},
+	}
+
+	for _, tt := range tests {
+		if got := IsTablePattern(tt.table); got != tt.expected {
+			t.Errorf("IsTablePattern(%q) = %v, expected %v", tt.table, got, tt.expected)
+		}
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{
+			name:    "no sources",
+			content: `{"handler": "handler.js", "sources": []}`,
+		},
+		{
+			name:    "missing handler",
+			content: `{"sources": [{"name": "a", "user": "u", "schema": "s", "tables": ["t"]}]}`,
+		},
+		{
+			name:    "missing name",
+			content: `{"handler": "handler.js", "sources": [{"user": "u", "schema": "s", "tables": ["t"]}]}`,
+		},
+		{
+			name: "duplicate name",
+			content: `{"handler": "handler.js", "sources": [
+				{"name": "a", "user": "u", "schema": "s", "tables": ["t"]},
+				{"name": "a", "user": "u", "schema": "s", "tables": ["t"]}
+			]}`,
+		},
+		{
+			name:    "missing tables",
+			content: `{"handler": "handler.js", "sources": [{"name": "a", "user": "u", "schema": "s"}]}`,
+		},
+		{
+			name:    "invalid duration",
+			content: `{"handler": "handler.js", "sources": [{"name": "a", "user": "u", "schema": "s", "tables": ["t"], "heartbeat_period": 10}]}`,
+		},
+		{
+			name:    "checkpoint with state",
+			content: `{"handler": "handler.js", "state": "state.db", "sources": [{"name": "a", "user": "u", "schema": "s", "tables": ["t"], "checkpoint": "a.pos"}]}`,
+		},
+		{
+			name:    "unknown sink type",
+			content: `{"handler": "handler.js", "sinks": {"out": {"type": "kafka"}}, "sources": [{"name": "a", "user": "u", "schema": "s", "tables": ["t"]}]}`,
+		},
+		{
+			name:    "file sink without path",
+			content: `{"handler": "handler.js", "sinks": {"out": {"type": "file"}}, "sources": [{"name": "a", "user": "u", "schema": "s", "tables": ["t"]}]}`,
+		},
+		{
+			name:    "undefined default sink",
+			content: `{"handler": "handler.js", "default_sink": "out", "sources": [{"name": "a", "user": "u", "schema": "s", "tables": ["t"]}]}`,
+		},
+		{
+			name:    "undefined dead letter sink",
+			content: `{"handler": "handler.js", "dead_letter_sink": "failed", "sources": [{"name": "a", "user": "u", "schema": "s", "tables": ["t"]}]}`,
+		},
+		{
+			name:    "stages missing a table",
+			content: `{"stages": {"s.t": [{"handler": "t.js"}]}, "sources": [{"name": "a", "user": "u", "schema": "s", "tables": ["t", "u"]}]}`,
+		},
+		{
+			name:    "stages with a table pattern",
+			content: `{"stages": {"s.t": [{"handler": "t.js"}]}, "sources": [{"name": "a", "user": "u", "schema": "s", "tables": ["t", "u_.*"]}]}`,
+		},
+		{
+			name:    "stage without handler",
+			content: `{"handler": "handler.js", "stages": {"s.t": [{"name": "filter"}]}, "sources": [{"name": "a", "user": "u", "schema": "s", "tables": ["t"]}]}`,
+		},
+		{
+			name:    "unknown stage error policy",
+			content: `{"handler": "handler.js", "stages": {"s.t": [{"handler": "t.js", "on_error": "ignore"}]}, "sources": [{"name": "a", "user": "u", "schema": "s", "tables": ["t"]}]}`,
+		},
+		{
+			name:    "empty stages",
+			content: `{"handler": "handler.js", "stages": {"s.t": []}, "sources": [{"name": "a", "user": "u", "schema": "s", "tables": ["t"]}]}`,
+		},
+		{
+			name:    "malformed",
+			content: `{"sources": [`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Load(writeConfig(t, tt.content)); err == nil {
+				t.Errorf("Load() expected error")
+			}
+		})
+	}
+}
+
+func TestHandlerConfigResolve(t *testing.T) {
+	secret := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(secret, []byte("s3cret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("DBSCRIPT_REGION", "eu-west-1")
+
+	h := HandlerConfig{
+		Values:  map[string]any{"threshold": 10.0},
+		Env:     []string{"DBSCRIPT_REGION", "DBSCRIPT_UNSET"},
+		Secrets: map[string]string{"token": secret},
+	}
+
+	resolved, err := h.Resolve()
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+
+	expected := map[string]any{"threshold": 10.0, "DBSCRIPT_REGION": "eu-west-1", "token": "s3cret"}
+	if !reflect.DeepEqual(resolved, expected) {
+		t.Errorf("Resolve() = %v, expected %v", resolved, expected)
+	}
+
+	h.Values["token"] = "value"
+	if _, err := h.Resolve(); err == nil {
+		t.Errorf("Resolve() expected error for a duplicate key")
+	}
+
+	h = HandlerConfig{Secrets: map[string]string{"missing": filepath.Join(t.TempDir(), "missing")}}
+	if _, err := h.Resolve(); err == nil {
+		t.Errorf("Resolve() expected error for a missing secret")
+	}
+}
@@ -0,0 +1,160 @@
+package event
+
+import (
+	"github.com/JayJamieson/dbscript/pkg/mysql"
+	"github.com/google/uuid"
+)
+
+// Metadata keys set on every event.
+const (
+	MetadataID         = "id"
+	MetadataTimestamp  = "timestamp"
+	MetadataSource     = "source"
+	MetadataRetryCount = "retryCount"
+
+	// MetadataError is the error of a dead lettered event.
+	MetadataError = "error"
+
+	// MetadataParentID is the id of the event an emitted event was derived
+	// from.
+	MetadataParentID = "parentId"
+)
+
+// Event is what handlers and sinks work with, a row change payload wrapped
+// with metadata handlers are free to extend.
+type Event struct {
+	Metadata map[string]any `json:"metadata"`
+	Payload  any            `json:"payload"`
+
+	// Sinks are the named sinks the event is delivered to, the default sink
+	// when empty. Key is the key emitted events are delivered with, sinks
+	// write it next to metadata and payload.
+	Sinks []string `json:"-"`
+	Key   string   `json:"key,omitempty"`
+}
+
+// New wraps a row change in an Event with a new id. The timestamp is the
+// binlog event time in seconds since the unix epoch.
+func New(change mysql.RowChangeEvent) Event {
+	return Event{
+		Metadata: map[string]any{
+			MetadataID:        uuid.NewString(),
+			MetadataTimestamp: int64(change.TimeStamp),
+			MetadataSource:    change.Source,
+		},
+		Payload: Payload(change),
+	}
+}
+
+// Payload converts a row change into a map keyed by its JSON field names so
+// handlers can modify it freely.
+func Payload(change mysql.RowChangeEvent) map[string]any {
+	return map[string]any{
+		"source":     change.Source,
+		"database":   change.Database,
+		"table":      change.Table,
+		"type":       change.Type,
+		"ts":         int64(change.TimeStamp),
+		"position":   change.Position,
+		"server_id":  change.ServerID,
+		"pk":         change.PrimaryKey,
+		"pk_columns": change.PrimaryKeyColumns,
+		"before":     change.Before,
+		"after":      change.After,
+	}
+}
+
+// TableOf returns "database.table" of the row change in the payload, empty
+// when the payload is not a row change.
+func TableOf(e Event) string {
+	payload, ok := e.Payload.(map[string]any)
+	if !ok {
+		return ""
+	}
+
+	database, _ := payload["database"].(string)
+	table, _ := payload["table"].(string)
+
+	if table == "" {
+		return ""
+	}
+
+	return database + "." + table
+}
+
+// RetryCount returns how many times the event has been retried.
+func (e Event) RetryCount() int {
+	switch count := e.Metadata[MetadataRetryCount].(type) {
+	case int:
+		return count
+	case int64:
+		return int(count)
+	case float64:
+		return int(count)
+	default:
+		return 0
+	}
+}
+
+// WithRetryCount returns a copy of the event with retryCount set in metadata.
+func (e Event) WithRetryCount(count int) Event {
+	metadata := make(map[string]any, len(e.Metadata)+1)
+	for k, v := range e.Metadata {
+		metadata[k] = v
+	}
+	metadata[MetadataRetryCount] = count
+
+	return Event{Metadata: metadata, Payload: e.Payload, Sinks: e.Sinks, Key: e.Key}
+}
+
+// WithError returns a copy of the event with error set in metadata.
+func (e Event) WithError(err error) Event {
+	metadata := make(map[string]any, len(e.Metadata)+1)
+	for k, v := range e.Metadata {
+		metadata[k] = v
+	}
+	metadata[MetadataError] = err.Error()
+
+	return Event{Metadata: metadata, Payload: e.Payload, Sinks: e.Sinks, Key: e.Key}
+}
+
+// Action is what a handler decided to do with an event.
+type Action int
+
+const (
+	// Ok forwards the event to the sink.
+	Ok Action = iota
+	// Drop skips the event.
+	Drop
+	// Error schedules the event for a retry.
+	Error
+)
+
+func (a Action) String() string {
+	switch a {
+	case Ok:
+		return "ok"
+	case Drop:
+		return "drop"
+	case Error:
+		return "error"
+	default:
+		return "unknown"
+	}
+}
+
+// Outcome is the result of a single handler invocation.
+type Outcome struct {
+	Action Action
+	Event  Event
+
+	// Reason is set when the event was dropped.
+	Reason string
+
+	// Err is set when the event errored.
+	Err error
+
+	// Emitted are the additional events the invocation emitted in order,
+	// they are delivered unless the event errored.
+	Emitted []Event
+}
@@ -0,0 +1,58 @@
+package javascript
+
+import (
+	"strings"
+
+	"github.com/grafana/sobek"
+)
+
+// builtinModules are the modules implemented in Go, scripts load them with
+// require("dbscript:<name>") or import ... from "dbscript:<name>". Export
+// names must be valid identifiers to be importable by name.
+var builtinModules = map[string]func(js *JavaScript) (*sobek.Object, error){
+	"crypto": newCryptoModule,
+	"mask":   newMaskModule,
+}
+
+// newMaskModule provides helpers for masking personal data.
+func newMaskModule(js *JavaScript) (*sobek.Object, error) {
+	exports := js.vm.NewObject()
+
+	functions := map[string]any{
+		"redact": maskRedact,
+		"email":  maskEmail,
+	}
+
+	for name, fn := range functions {
+		if err := exports.Set(name, fn); err != nil {
+			return nil, err
+		}
+	}
+
+	return exports, nil
+}
+
+// maskRedact replaces every character except the last keep ones with "*".
+func maskRedact(value string, keep int) string {
+	runes := []rune(value)
+	if keep < 0 {
+		keep = 0
+	}
+	if keep > len(runes) {
+		keep = len(runes)
+	}
+
+	return strings.Repeat("*", len(runes)-keep) + string(runes[len(runes)-keep:])
+}
+
+// maskEmail keeps the first character of the local part and the domain.
+func maskEmail(value string) string {
+	local, domain, ok := strings.Cut(value, "@")
+	if !ok || local == "" {
+		return maskRedact(value, 0)
+	}
+
+	runes := []rune(local)
+
+	return string(runes[0]) + strings.Repeat("*", len(runes)-1) + "@" + domain
+}
@@ -0,0 +1,175 @@
+package javascript
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sort"
+	"strings"
+
+	"github.com/JayJamieson/dbscript/pkg/event"
+	"github.com/grafana/sobek"
+)
+
+// DefaultLogLimit is how many messages a handler may log per invocation,
+// further messages are dropped.
+const DefaultLogLimit = 100
+
+// handlerLog routes console and dbscript.log messages into the process logger
+// with the handler name and the current event attached.
+type handlerLog struct {
+	base   *slog.Logger
+	logger *slog.Logger
+	limit  int
+
+	count   int
+	dropped int
+}
+
+func newHandlerLog(logger *slog.Logger, name string, limit int) *handlerLog {
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	if limit == 0 {
+		limit = DefaultLogLimit
+	}
+
+	base := logger.With("handler", name)
+
+	return &handlerLog{base: base, logger: base, limit: limit}
+}
+
+// reset attaches the event to messages logged by the next invocation and
+// restarts the rate limit.
+func (l *handlerLog) reset(e event.Event) {
+	l.logger = l.base.With("event_id", e.Metadata[event.MetadataID], "table", event.TableOf(e))
+	l.count = 0
+	l.dropped = 0
+}
+
+// resetBatch prepares the logger for a handleBatch invocation.
+func (l *handlerLog) resetBatch(events []event.Event) {
+	l.logger = l.base.With("batch_size", len(events))
+	l.count = 0
+	l.dropped = 0
+}
+
+// resetHook prepares the logger for init and shutdown, their messages carry
+// no event.
+func (l *handlerLog) resetHook() {
+	l.logger = l.base
+	l.count = 0
+	l.dropped = 0
+}
+
+// flush reports messages dropped by the rate limit during the invocation.
+func (l *handlerLog) flush() {
+	if l.dropped > 0 {
+		l.logger.Warn("Dropped handler log messages", "dropped", l.dropped, "limit", l.limit)
+	}
+}
+
+func (l *handlerLog) log(level slog.Level, msg string, attrs ...slog.Attr) {
+	if l.limit > 0 && l.count >= l.limit {
+		l.dropped++
+		return
+	}
+
+	l.count++
+	l.logger.LogAttrs(context.Background(), level, msg, attrs...)
+}
+
+// logFields converts the fields object of dbscript.log calls into attributes
+// sorted by key.
+func logFields(fields map[string]any) []slog.Attr {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	attrs := make([]slog.Attr, 0, len(keys))
+	for _, key := range keys {
+		attrs = append(attrs, slog.Any(key, fields[key]))
+	}
+
+	return attrs
+}
+
+// Logger is exposed to scripts as dbscript.log.
+type Logger struct {
+	log *handlerLog
+}
+
+func (l *Logger) Debug(msg string, fields map[string]any) {
+	l.log.log(slog.LevelDebug, msg, logFields(fields)...)
+}
+
+func (l *Logger) Info(msg string, fields map[string]any) {
+	l.log.log(slog.LevelInfo, msg, logFields(fields)...)
+}
+
+func (l *Logger) Warn(msg string, fields map[string]any) {
+	l.log.log(slog.LevelWarn, msg, logFields(fields)...)
+}
+
+func (l *Logger) Error(msg string, fields map[string]any) {
+	l.log.log(slog.LevelError, msg, logFields(fields)...)
+}
+
+// console is exposed to scripts as the console global, arguments are joined
+// with spaces like browsers do.
+type console struct {
+	log *handlerLog
+}
+
+func (c *console) Debug(args ...sobek.Value) {
+	c.log.log(slog.LevelDebug, formatArgs(args))
+}
+
+func (c *console) Log(args ...sobek.Value) {
+	c.log.log(slog.LevelInfo, formatArgs(args))
+}
+
+func (c *console) Info(args ...sobek.Value) {
+	c.log.log(slog.LevelInfo, formatArgs(args))
+}
+
+func (c *console) Warn(args ...sobek.Value) {
+	c.log.log(slog.LevelWarn, formatArgs(args))
+}
+
+func (c *console) Error(args ...sobek.Value) {
+	c.log.log(slog.LevelError, formatArgs(args))
+}
+
+// formatArgs prints strings as is, errors as their message and other values
+// as JSON.
+func formatArgs(args []sobek.Value) string {
+	parts := make([]string, 0, len(args))
+
+	for _, arg := range args {
+		parts = append(parts, formatArg(arg))
+	}
+
+	return strings.Join(parts, " ")
+}
+
+func formatArg(arg sobek.Value) string {
+	if arg == nil {
+		return "undefined"
+	}
+
+	if obj, ok := arg.(*sobek.Object); ok {
+		if obj.ClassName() == "Error" || obj.ClassName() == "Function" {
+			return arg.String()
+		}
+
+		if data, err := json.Marshal(obj.Export()); err == nil {
+			return string(data)
+		}
+	}
+
+	return arg.String()
+}
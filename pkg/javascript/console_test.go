@@ -0,0 +1,125 @@
+package javascript
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+// logLines decodes the JSON log lines written to buf.
+func logLines(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+
+	var lines []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+
+		var decoded map[string]any
+		if err := json.Unmarshal([]byte(line), &decoded); err != nil {
+			t.Fatalf("invalid log line %q: %v", line, err)
+		}
+		lines = append(lines, decoded)
+	}
+
+	return lines
+}
+
+func TestConsole(t *testing.T) {
+	var buf bytes.Buffer
+
+	js, err := New(Options{
+		Name:   "handler.js",
+		Logger: slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})),
+		Script: `
+			function handle(event) {
+				console.log("email", event.payload.after.email, { id: 1 });
+				console.warn(new Error("bad row"));
+				dbscript.log.info("masked", { column: "email", count: 2 });
+				dbscript.log.error("failed");
+			}
+		`,
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	e := createTestEvent()
+	if _, err := js.Execute(e); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	lines := logLines(t, &buf)
+
+	tests := []struct {
+		level string
+		msg   string
+		attrs map[string]any
+	}{
+		{"INFO", `email john.doe@example.com {"id":1}`, nil},
+		{"WARN", "Error: bad row", nil},
+		{"INFO", "masked", map[string]any{"column": "email", "count": float64(2)}},
+		{"ERROR", "failed", nil},
+	}
+
+	if len(lines) != len(tests) {
+		t.Fatalf("logged %d lines, expected %d: %v", len(lines), len(tests), lines)
+	}
+
+	for i, tt := range tests {
+		line := lines[i]
+
+		if line["level"] != tt.level || line["msg"] != tt.msg {
+			t.Errorf("line %d = %v %q, expected %v %q", i, line["level"], line["msg"], tt.level, tt.msg)
+		}
+
+		if line["handler"] != "handler.js" || line["event_id"] != e.Metadata["id"] || line["table"] != "dbscript.user" {
+			t.Errorf("line %d = %v, expected handler, event_id and table attributes", i, line)
+		}
+
+		for key, value := range tt.attrs {
+			if line[key] != value {
+				t.Errorf("line %d %s = %v, expected %v", i, key, line[key], value)
+			}
+		}
+	}
+}
+
+func TestConsoleLimit(t *testing.T) {
+	var buf bytes.Buffer
+
+	js, err := New(Options{
+		Logger:   slog.New(slog.NewJSONHandler(&buf, nil)),
+		LogLimit: 3,
+		Script: `
+			function handle(event) {
+				for (var i = 0; i < 10; i++) {
+					console.log("line", i);
+				}
+			}
+		`,
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		buf.Reset()
+
+		if _, err := js.Execute(createTestEvent()); err != nil {
+			t.Fatalf("Execute() error = %v", err)
+		}
+
+		lines := logLines(t, &buf)
+		if len(lines) != 4 {
+			t.Fatalf("logged %d lines, expected 3 messages and a dropped warning", len(lines))
+		}
+
+		if dropped := lines[3]["dropped"]; dropped != float64(7) {
+			t.Errorf("dropped = %v, expected 7", dropped)
+		}
+	}
+}
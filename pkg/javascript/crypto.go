@@ -0,0 +1,307 @@
+package javascript
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"net/url"
+	"os"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/grafana/sobek"
+)
+
+// maxRandomBytes bounds randomBytes so a handler cannot allocate unbounded
+// memory.
+const maxRandomBytes = 1 << 16
+
+// cryptoKey is an AES key loaded from a file, scripts only hold a handle to
+// it and never see the key material.
+type cryptoKey struct {
+	path string
+	aead cipher.AEAD
+}
+
+// newCryptoModule provides hashing, encryption, random and encoding helpers.
+// Data arguments are UTF-8 text or bytes, decoded and decrypted data is
+// returned as a Uint8Array so binary values are not mangled.
+func newCryptoModule(js *JavaScript) (*sobek.Object, error) {
+	exports := js.vm.NewObject()
+
+	// keys are loaded once per VM
+	keys := make(map[string]*cryptoKey)
+
+	toBytes := func(data []byte, err error) (sobek.Value, error) {
+		if err != nil {
+			return nil, err
+		}
+		return newUint8Array(js.vm, data)
+	}
+
+	functions := map[string]any{
+		"sha256": func(data sobek.Value) (string, error) {
+			b, err := bytesArg(data)
+			sum := sha256.Sum256(b)
+			return hex.EncodeToString(sum[:]), err
+		},
+		"sha512": func(data sobek.Value) (string, error) {
+			b, err := bytesArg(data)
+			sum := sha512.Sum512(b)
+			return hex.EncodeToString(sum[:]), err
+		},
+		"hmac": cryptoHMAC,
+
+		"loadKey": func(path string) (*cryptoKey, error) {
+			if key, ok := keys[path]; ok {
+				return key, nil
+			}
+
+			key, err := loadCryptoKey(path)
+			if err != nil {
+				return nil, err
+			}
+
+			keys[path] = key
+			return key, nil
+		},
+		"encrypt": cryptoEncrypt,
+		"decrypt": func(key *cryptoKey, ciphertext string, aad sobek.Value) (sobek.Value, error) {
+			return toBytes(cryptoDecrypt(key, ciphertext, aad))
+		},
+
+		"randomBytes": cryptoRandomBytes,
+		"uuidv4": func() string {
+			return uuid.NewString()
+		},
+		"uuidv7": func() (string, error) {
+			id, err := uuid.NewV7()
+			if err != nil {
+				return "", err
+			}
+			return id.String(), nil
+		},
+
+		"base64Encode": func(data sobek.Value) (string, error) {
+			b, err := bytesArg(data)
+			return base64.StdEncoding.EncodeToString(b), err
+		},
+		"base64Decode": func(data string) (sobek.Value, error) {
+			return toBytes(base64.StdEncoding.DecodeString(data))
+		},
+		"base64UrlEncode": func(data sobek.Value) (string, error) {
+			b, err := bytesArg(data)
+			return base64.RawURLEncoding.EncodeToString(b), err
+		},
+		"base64UrlDecode": func(data string) (sobek.Value, error) {
+			return toBytes(base64.RawURLEncoding.DecodeString(data))
+		},
+		"hexEncode": func(data sobek.Value) (string, error) {
+			b, err := bytesArg(data)
+			return hex.EncodeToString(b), err
+		},
+		"hexDecode": func(data string) (sobek.Value, error) {
+			return toBytes(hex.DecodeString(data))
+		},
+		"utf8Decode": func(data sobek.Value) (string, error) {
+			b, err := bytesArg(data)
+			if err == nil && !utf8.Valid(b) {
+				err = errors.New("utf8Decode: data is not valid UTF-8")
+			}
+			return string(b), err
+		},
+		"urlEncode": url.QueryEscape,
+		"urlDecode": url.QueryUnescape,
+	}
+
+	for name, fn := range functions {
+		if err := exports.Set(name, fn); err != nil {
+			return nil, err
+		}
+	}
+
+	return exports, nil
+}
+
+// bytesArg returns the bytes of a string, Uint8Array or ArrayBuffer argument,
+// strings are UTF-8 encoded.
+func bytesArg(value sobek.Value) ([]byte, error) {
+	if value == nil {
+		return nil, errors.New("expected a string, Uint8Array or ArrayBuffer")
+	}
+
+	switch data := value.Export().(type) {
+	case string:
+		return []byte(data), nil
+	case []byte:
+		return data, nil
+	case sobek.ArrayBuffer:
+		return data.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("expected a string, Uint8Array or ArrayBuffer, got %s", value)
+	}
+}
+
+// newUint8Array returns a Uint8Array over data.
+func newUint8Array(vm *sobek.Runtime, data []byte) (sobek.Value, error) {
+	ctor, ok := sobek.AssertConstructor(vm.Get("Uint8Array"))
+	if !ok {
+		return nil, errors.New("Uint8Array is not a constructor")
+	}
+
+	return ctor(nil, vm.ToValue(vm.NewArrayBuffer(data)))
+}
+
+// cryptoHMAC returns the hex encoded HMAC of data using sha256 or sha512.
+func cryptoHMAC(algorithm, key string, data sobek.Value) (string, error) {
+	var newHash func() hash.Hash
+
+	switch algorithm {
+	case "sha256":
+		newHash = sha256.New
+	case "sha512":
+		newHash = sha512.New
+	default:
+		return "", fmt.Errorf("unsupported hmac algorithm %q, expected sha256 or sha512", algorithm)
+	}
+
+	b, err := bytesArg(data)
+	if err != nil {
+		return "", err
+	}
+
+	mac := hmac.New(newHash, []byte(key))
+	mac.Write(b)
+
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// loadCryptoKey reads a 128, 192 or 256 bit AES key stored raw, hex or
+// base64 encoded.
+func loadCryptoKey(path string) (*cryptoKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := decodeKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("loading key %s: %w", path, err)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("loading key %s: %w", path, err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("loading key %s: %w", path, err)
+	}
+
+	return &cryptoKey{path: path, aead: aead}, nil
+}
+
+// decodeKey returns the key in data, hex or base64 encoded text is decoded
+// before data is taken as a raw key. A 32 character hex key is a 16 byte key
+// even though 32 raw bytes would be a valid key as well.
+func decodeKey(data []byte) ([]byte, error) {
+	text := string(bytes.TrimSpace(data))
+
+	if key, err := hex.DecodeString(text); err == nil && validKeySize(len(key)) {
+		return key, nil
+	}
+
+	if key, err := base64.StdEncoding.DecodeString(text); err == nil && validKeySize(len(key)) {
+		return key, nil
+	}
+
+	if validKeySize(len(data)) {
+		return data, nil
+	}
+
+	return nil, errors.New("key must be 16, 24 or 32 bytes, raw, hex or base64 encoded")
+}
+
+func validKeySize(size int) bool {
+	return size == 16 || size == 24 || size == 32
+}
+
+// cryptoEncrypt seals plaintext with AES-GCM and returns the base64 encoded
+// nonce followed by the ciphertext. aad is optional additional data that must
+// be given again to decrypt.
+func cryptoEncrypt(key *cryptoKey, data sobek.Value, aad sobek.Value) (string, error) {
+	if key == nil {
+		return "", errors.New("encrypt requires a key from loadKey")
+	}
+
+	plaintext, err := bytesArg(data)
+	if err != nil {
+		return "", fmt.Errorf("encrypt: %w", err)
+	}
+
+	nonce := make([]byte, key.aead.NonceSize(), key.aead.NonceSize()+len(plaintext)+key.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := key.aead.Seal(nonce, nonce, plaintext, additionalData(aad))
+
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// cryptoDecrypt opens a value returned by encrypt.
+func cryptoDecrypt(key *cryptoKey, ciphertext string, aad sobek.Value) ([]byte, error) {
+	if key == nil {
+		return nil, errors.New("decrypt requires a key from loadKey")
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt: %w", err)
+	}
+
+	if len(sealed) < key.aead.NonceSize() {
+		return nil, errors.New("decrypt: ciphertext too short")
+	}
+
+	nonce, sealed := sealed[:key.aead.NonceSize()], sealed[key.aead.NonceSize():]
+
+	plaintext, err := key.aead.Open(nil, nonce, sealed, additionalData(aad))
+	if err != nil {
+		return nil, fmt.Errorf("decrypt: %w", err)
+	}
+
+	return plaintext, nil
+}
+
+func additionalData(aad sobek.Value) []byte {
+	if aad == nil || sobek.IsUndefined(aad) || sobek.IsNull(aad) {
+		return nil
+	}
+
+	return []byte(aad.String())
+}
+
+// cryptoRandomBytes returns n hex encoded bytes from a secure source.
+func cryptoRandomBytes(n int) (string, error) {
+	if n < 0 || n > maxRandomBytes {
+		return "", fmt.Errorf("randomBytes size must be between 0 and %d", maxRandomBytes)
+	}
+
+	data := make([]byte, n)
+	if _, err := rand.Read(data); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(data), nil
+}
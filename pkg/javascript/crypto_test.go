@@ -0,0 +1,167 @@
+package javascript
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// evalCrypto runs expr in a handler with the crypto module loaded as crypto
+// and returns the result stored in metadata.
+func evalCrypto(t *testing.T, setup string, expr string) (any, error) {
+	t.Helper()
+
+	js, err := New(Options{Script: `
+		var crypto = require("dbscript:crypto");
+		` + setup + `
+		function handle(event) { event.metadata.result = ` + expr + `; }
+	`})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	outcome, err := js.Execute(createTestEvent())
+	if err != nil {
+		return nil, err
+	}
+
+	return outcome.Event.Metadata["result"], nil
+}
+
+func TestCrypto(t *testing.T) {
+	tests := []struct {
+		expr     string
+		expected any
+	}{
+		{`crypto.sha256("abc")`, "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		{`crypto.sha512("abc").slice(0, 16)`, "ddaf35a193617aba"},
+		{`crypto.hmac("sha256", "key", "The quick brown fox jumps over the lazy dog")`, "f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8"},
+		{`crypto.base64Encode("héllo")`, "aMOpbGxv"},
+		{`crypto.utf8Decode(crypto.base64Decode("aMOpbGxv"))`, "héllo"},
+		{`crypto.base64UrlEncode("??>")`, "Pz8-"},
+		{`crypto.utf8Decode(crypto.base64UrlDecode("Pz8-"))`, "??>"},
+		{`crypto.hexEncode("hi")`, "6869"},
+		{`crypto.utf8Decode(crypto.hexDecode("6869"))`, "hi"},
+		{`crypto.hexDecode("ff00") instanceof Uint8Array`, true},
+		{`crypto.hexEncode(crypto.base64Decode("/wCA"))`, "ff0080"},
+		{`crypto.base64UrlEncode(crypto.hexDecode("fbff").buffer)`, "-_8"},
+		{`crypto.sha256(crypto.hexDecode("616263"))`, "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		{`crypto.urlEncode("a b&c")`, "a+b%26c"},
+		{`crypto.urlDecode("a+b%26c")`, "a b&c"},
+		{`crypto.randomBytes(16).length`, int64(32)},
+		{`crypto.uuidv4().charAt(14)`, "4"},
+		{`crypto.uuidv7().charAt(14)`, "7"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			result, err := evalCrypto(t, "", tt.expr)
+			if err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+
+			if result != tt.expected {
+				t.Errorf("%s = %v, expected %v", tt.expr, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCryptoEncrypt(t *testing.T) {
+	dir := t.TempDir()
+
+	keys := map[string]string{
+		"raw.key":    strings.Repeat("k!", 16),
+		"hex.key":    strings.Repeat("ab", 16) + "\n",
+		"base64.key": "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3\n",
+	}
+
+	for name, key := range keys {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(key), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		t.Run(name, func(t *testing.T) {
+			setup := `var key = crypto.loadKey(` + jsString(path) + `);`
+
+			result, err := evalCrypto(t, setup, `crypto.utf8Decode(crypto.decrypt(key, crypto.encrypt(key, "secret", "id:1"), "id:1"))`)
+			if err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+
+			if result != "secret" {
+				t.Errorf("decrypt(encrypt()) = %v, expected secret", result)
+			}
+
+			// bytes that are not UTF-8 survive the round trip
+			result, err = evalCrypto(t, setup, `crypto.hexEncode(crypto.decrypt(key, crypto.encrypt(key, crypto.hexDecode("ff00fe80"))))`)
+			if err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+
+			if result != "ff00fe80" {
+				t.Errorf("decrypt(encrypt()) of binary = %v, expected ff00fe80", result)
+			}
+
+			_, err = evalCrypto(t, setup, `crypto.decrypt(key, crypto.encrypt(key, "secret", "id:1"), "id:2")`)
+			if err == nil {
+				t.Errorf("decrypt() with different additional data expected an error")
+			}
+		})
+	}
+
+	bad := filepath.Join(dir, "bad.key")
+	if err := os.WriteFile(bad, []byte("short"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := evalCrypto(t, "", `crypto.loadKey(`+jsString(bad)+`)`); err == nil || !strings.Contains(err.Error(), "16, 24 or 32 bytes") {
+		t.Errorf("loadKey() error = %v, expected a key size error", err)
+	}
+}
+
+func TestCryptoBytesErrors(t *testing.T) {
+	for _, expr := range []string{
+		`crypto.utf8Decode(crypto.hexDecode("ff"))`,
+		`crypto.hexEncode(42)`,
+		`crypto.base64Encode()`,
+	} {
+		t.Run(expr, func(t *testing.T) {
+			if _, err := evalCrypto(t, "", expr); err == nil {
+				t.Errorf("%s expected an error", expr)
+			}
+		})
+	}
+}
+
+func TestDecodeKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		expected int
+	}{
+		{name: "hex of 32 characters", data: strings.Repeat("ab", 16), expected: 16},
+		{name: "base64 of 24 characters", data: "MDEyMzQ1Njc4OWFiY2RlZg==", expected: 16},
+		{name: "hex of 64 characters", data: strings.Repeat("ab", 32), expected: 32},
+		{name: "raw", data: strings.Repeat("k!", 12), expected: 24},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := decodeKey([]byte(tt.data))
+			if err != nil {
+				t.Fatalf("decodeKey() error = %v", err)
+			}
+
+			if len(key) != tt.expected {
+				t.Errorf("len(key) = %d, expected %d", len(key), tt.expected)
+			}
+		})
+	}
+}
+
+func jsString(s string) string {
+	return `"` + strings.ReplaceAll(s, `\`, `\\`) + `"`
+}
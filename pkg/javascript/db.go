@@ -0,0 +1,204 @@
+package javascript
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"time"
+)
+
+const (
+	// DefaultQueryTimeout bounds a single dbscript.db.query call.
+	DefaultQueryTimeout = 2 * time.Second
+
+	// DefaultQueryCacheSize is how many query results are cached.
+	DefaultQueryCacheSize = 1000
+
+	// DefaultQueryCacheTTL is how long a cached result is used.
+	DefaultQueryCacheTTL = time.Minute
+)
+
+// Database runs read-only queries against a source.
+type Database interface {
+	Query(ctx context.Context, query string, args ...any) ([]map[string]any, error)
+}
+
+// DBOptions configures dbscript.db. Queries run against the source of the
+// current event, with no sources dbscript.db.query always fails.
+type DBOptions struct {
+	// Sources maps source names to their database.
+	Sources map[string]Database
+
+	// Timeout bounds each query, queries never outlive the handler execution
+	// timeout.
+	Timeout time.Duration
+
+	// CacheSize is how many results are kept, least recently used first out.
+	// Negative disables the cache.
+	CacheSize int
+	CacheTTL  time.Duration
+}
+
+// DB is dbscript.db.
+type DB struct {
+	js      *JavaScript
+	options DBOptions
+	cache   *queryCache
+}
+
+func newDB(js *JavaScript, options DBOptions) *DB {
+	if options.Timeout <= 0 {
+		options.Timeout = DefaultQueryTimeout
+	}
+
+	if options.CacheSize == 0 {
+		options.CacheSize = DefaultQueryCacheSize
+	}
+
+	if options.CacheTTL <= 0 {
+		options.CacheTTL = DefaultQueryCacheTTL
+	}
+
+	return &DB{js: js, options: options, cache: newQueryCache(options.CacheSize, options.CacheTTL)}
+}
+
+// Query runs a parameterized read-only statement against the source of the
+// current event and returns its rows. Results are cached by source, query
+// and params.
+func (db *DB) Query(query string, params []any) ([]any, error) {
+	if len(db.options.Sources) == 0 {
+		return nil, errors.New("db is not configured")
+	}
+
+	source, database, err := db.database()
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := json.Marshal([]any{source, query, params})
+	if err != nil {
+		return nil, fmt.Errorf("query params must be JSON encodable: %w", err)
+	}
+
+	if rows, ok := db.cache.get(string(key)); ok {
+		return copyRows(rows), nil
+	}
+
+	// queries count against the execution timeout of the invocation
+	ctx := context.Background()
+	if !db.js.deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, db.js.deadline)
+		defer cancel()
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, db.options.Timeout)
+	defer cancel()
+
+	rows, err := database.Query(ctx, query, params...)
+	if err != nil {
+		return nil, err
+	}
+
+	db.cache.put(string(key), rows)
+
+	return copyRows(rows), nil
+}
+
+// database returns the database of the current event's source, or the only
+// one outside of an event.
+func (db *DB) database() (string, Database, error) {
+	source := db.js.runtime.Context.source()
+
+	if source == "" && len(db.options.Sources) == 1 {
+		for name, database := range db.options.Sources {
+			return name, database, nil
+		}
+	}
+
+	database, ok := db.options.Sources[source]
+	if !ok {
+		return "", nil, fmt.Errorf("no database for source %q", source)
+	}
+
+	return source, database, nil
+}
+
+// copyRows keeps handlers from modifying cached rows.
+func copyRows(rows []map[string]any) []any {
+	out := make([]any, len(rows))
+	for i, row := range rows {
+		out[i] = maps.Clone(row)
+	}
+
+	return out
+}
+
+// queryCache is a least recently used cache of query results.
+type queryCache struct {
+	size    int
+	ttl     time.Duration
+	order   *list.List
+	entries map[string]*list.Element
+	now     func() time.Time
+}
+
+type queryCacheEntry struct {
+	key       string
+	rows      []map[string]any
+	expiresAt time.Time
+}
+
+func newQueryCache(size int, ttl time.Duration) *queryCache {
+	return &queryCache{
+		size:    size,
+		ttl:     ttl,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+		now:     time.Now,
+	}
+}
+
+func (c *queryCache) get(key string) ([]map[string]any, bool) {
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := element.Value.(*queryCacheEntry)
+
+	if !c.now().Before(entry.expiresAt) {
+		c.order.Remove(element)
+		delete(c.entries, key)
+		return nil, false
+	}
+
+	c.order.MoveToFront(element)
+
+	return entry.rows, true
+}
+
+func (c *queryCache) put(key string, rows []map[string]any) {
+	if c.size <= 0 {
+		return
+	}
+
+	entry := &queryCacheEntry{key: key, rows: rows, expiresAt: c.now().Add(c.ttl)}
+
+	if element, ok := c.entries[key]; ok {
+		element.Value = entry
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(entry)
+
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*queryCacheEntry).key)
+	}
+}
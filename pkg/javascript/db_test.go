@@ -0,0 +1,166 @@
+package javascript
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakeDatabase struct {
+	name    string
+	queries int
+	delay   time.Duration
+}
+
+func (d *fakeDatabase) Query(ctx context.Context, query string, args ...any) ([]map[string]any, error) {
+	d.queries++
+
+	if d.delay > 0 {
+		select {
+		case <-time.After(d.delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	return []map[string]any{{"source": d.name, "query": query, "id": args[0]}}, nil
+}
+
+func TestDBQuery(t *testing.T) {
+	database := &fakeDatabase{name: "default"}
+
+	js, err := New(Options{
+		DB: DBOptions{Sources: map[string]Database{"default": database, "other": &fakeDatabase{name: "other"}}},
+		Script: `
+			function handle(event) {
+				var rows = dbscript.db.query("SELECT * FROM user WHERE id = ?", [event.payload.after.id]);
+				event.metadata.source = rows[0].source;
+				event.metadata.id = rows[0].id;
+
+				// cached rows cannot be modified
+				rows[0].id = 42;
+				event.metadata.cached = dbscript.db.query("SELECT * FROM user WHERE id = ?", [event.payload.after.id])[0].id;
+				dbscript.db.query("SELECT * FROM user WHERE id = ?", [2]);
+			}
+		`,
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	outcome, err := js.Execute(createTestEvent())
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	expected := map[string]any{"source": "default", "id": int64(1), "cached": int64(1)}
+
+	for key, value := range expected {
+		if outcome.Event.Metadata[key] != value {
+			t.Errorf("metadata[%q] = %#v, expected %#v", key, outcome.Event.Metadata[key], value)
+		}
+	}
+
+	if database.queries != 2 {
+		t.Errorf("queries = %d, expected 2", database.queries)
+	}
+}
+
+func TestDBQueryErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		options DBOptions
+		timeout time.Duration
+		err     string
+	}{
+		{
+			name: "not configured",
+			err:  "db is not configured",
+		},
+		{
+			name:    "unknown source",
+			options: DBOptions{Sources: map[string]Database{"a": &fakeDatabase{}, "b": &fakeDatabase{}}},
+			err:     `no database for source "default"`,
+		},
+		{
+			name:    "query timeout",
+			options: DBOptions{Sources: map[string]Database{"default": &fakeDatabase{delay: time.Second}}, Timeout: 10 * time.Millisecond},
+			err:     "deadline exceeded",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			js, err := New(Options{
+				DB:     tt.options,
+				Script: `function handle(event) { dbscript.db.query("SELECT 1", [1]); }`,
+			})
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			_, err = js.Execute(createTestEvent())
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Execute() error = %v, expected it to contain %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestDBQueryCountsAgainstTimeout(t *testing.T) {
+	js, err := New(Options{
+		Timeout: 50 * time.Millisecond,
+		DB:      DBOptions{Sources: map[string]Database{"default": &fakeDatabase{delay: 2 * time.Second}}, Timeout: time.Minute},
+		Script:  `function handle(event) { dbscript.db.query("SELECT 1", [1]); }`,
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	start := time.Now()
+	_, err = js.Execute(createTestEvent())
+
+	if err == nil || !strings.Contains(err.Error(), "deadline exceeded") {
+		t.Fatalf("Execute() error = %v, expected the query to hit the deadline", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Execute() took %s, expected the query to be cancelled at the handler timeout", elapsed)
+	}
+}
+
+func TestQueryCache(t *testing.T) {
+	cache := newQueryCache(2, time.Minute)
+
+	now := time.Unix(1000, 0)
+	cache.now = func() time.Time { return now }
+
+	cache.put("a", []map[string]any{{"id": 1}})
+	cache.put("b", []map[string]any{{"id": 2}})
+
+	// a becomes the most recently used, b is evicted by c
+	cache.get("a")
+	cache.put("c", []map[string]any{{"id": 3}})
+
+	tests := []struct {
+		key      string
+		expected bool
+	}{
+		{"a", true},
+		{"b", false},
+		{"c", true},
+	}
+
+	for _, tt := range tests {
+		if _, ok := cache.get(tt.key); ok != tt.expected {
+			t.Errorf("get(%q) ok = %v, expected %v", tt.key, ok, tt.expected)
+		}
+	}
+
+	now = now.Add(time.Minute)
+
+	if _, ok := cache.get("a"); ok {
+		t.Errorf("get(\"a\") after ttl expected a miss")
+	}
+}
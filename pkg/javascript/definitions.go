@@ -0,0 +1,201 @@
+package javascript
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/JayJamieson/dbscript/pkg/mysql"
+)
+
+// definitionsHeader declares the runtime API, the generated table types
+// follow it.
+const definitionsHeader = `// Code generated by dbscript types. DO NOT EDIT.
+
+declare namespace dbscript {
+  /** Event metadata, handlers may add their own keys. */
+  interface Metadata {
+    id: string;
+    /** Binlog event time in seconds since the unix epoch. */
+    timestamp: number;
+    source: string;
+    retryCount?: number;
+    [key: string]: unknown;
+  }
+
+  interface Change<Database extends string, Table extends string> {
+    source: string;
+    database: Database;
+    table: Table;
+    ts: number;
+    position: string;
+    server_id: string;
+    pk: unknown[];
+    pk_columns: string[];
+  }
+
+  type RowChange<Database extends string, Table extends string, Row> =
+    | (Change<Database, Table> & { type: "INSERT"; before: null; after: Row })
+    | (Change<Database, Table> & { type: "UPDATE"; before: Row; after: Row })
+    | (Change<Database, Table> & { type: "DELETE"; before: Row; after: null });
+
+  /** Row change of any monitored table, narrow it on table and type. */
+  type RowChangeEvent = {
+    [Name in keyof Tables]: Tables[Name]["change"];
+  }[keyof Tables];
+
+  interface Event<Payload = RowChangeEvent> {
+    metadata: Metadata;
+    payload: Payload;
+  }
+
+  type Handler<Payload = RowChangeEvent> = (event: Event<Payload>) => void | Promise<void>;
+
+  interface OperationHandlers<Payload> {
+    insert?: Handler<Extract<Payload, { type: "INSERT" }>>;
+    update?: Handler<Extract<Payload, { type: "UPDATE" }>>;
+    delete?: Handler<Extract<Payload, { type: "DELETE" }>>;
+  }
+
+  /** Handlers keyed by "database.table", "*" handles tables without an entry. */
+  type Handlers = {
+    [Name in keyof Tables]?: Handler<Tables[Name]["change"]> | OperationHandlers<Tables[Name]["change"]>;
+  } & { "*"?: Handler | OperationHandlers<RowChangeEvent> };
+
+  interface Lag {
+    source: string;
+    seconds: number;
+    bytes_behind: number;
+    position: string;
+    server_position: string;
+    updated_at: string;
+  }
+
+  interface EmitOptions {
+    /** Named sinks the event is delivered to instead of the default sink. */
+    sink?: string | string[];
+    /** Key the event is delivered with, such as a partition key. */
+    key?: string | number;
+    /** Event the new one is derived from, required in handleBatch. */
+    parent?: Event;
+  }
+
+  interface Context {
+    /** Returns the current event, null in handleBatch. */
+    getEvent(): Event;
+    /** Forwards the event, or the current event, to the named sinks or the default sink. */
+    ok(event?: Event, sinks?: string | string[]): void;
+    /** Skips the event recording why. */
+    drop(reason: string, event?: Event): void;
+    /** Schedules the event for a retry. */
+    error(err: unknown, event?: Event): void;
+    /** Delivers an additional event, new events only need a payload. */
+    emit(event: { metadata?: Metadata; payload: unknown }, options?: EmitOptions): void;
+  }
+
+  const ctx: Context;
+
+  interface State {
+    /** Returns the stored value, undefined when missing or expired. */
+    get(key: string): unknown;
+    /** Stores a JSON encodable value, ttl is in milliseconds. */
+    set(key: string, value: unknown, ttl?: number): void;
+    delete(key: string): void;
+    /** Adds by, 1 by default, to the number at key and returns it. */
+    incr(key: string, by?: number, ttl?: number): number;
+  }
+
+  const state: State;
+
+  interface DB {
+    /** Runs a read-only query against the source of the current event. */
+    query(sql: string, params?: unknown[]): Record<string, unknown>[];
+  }
+
+  const db: DB;
+
+  interface Log {
+    debug(msg: string, fields?: Record<string, unknown>): void;
+    info(msg: string, fields?: Record<string, unknown>): void;
+    warn(msg: string, fields?: Record<string, unknown>): void;
+    error(msg: string, fields?: Record<string, unknown>): void;
+  }
+
+  /** Structured logging, fields are added to the log record. */
+  const log: Log;
+
+  interface FetchOptions {
+    method?: string;
+    headers?: Record<string, string>;
+    body?: string;
+    /** Budget of each attempt in milliseconds. */
+    timeout?: number;
+    retries?: number;
+    /** Delay before the first retry in milliseconds, it backs off exponentially. */
+    retryDelay?: number;
+  }
+
+  interface FetchResponse {
+    url: string;
+    status: number;
+    statusText: string;
+    ok: boolean;
+    /** Header names are lower case. */
+    headers: Record<string, string>;
+    text(): string;
+    /** Parses the body, unlike the standard fetch it does not return a promise. */
+    json(): unknown;
+  }
+
+  /** Handler configuration, also passed to init. */
+  const config: Readonly<Record<string, unknown>>;
+
+  /** Replication lag of the named source, undefined when it is unknown. */
+  function lag(source: string): Lag | undefined;
+`
+
+// WriteDefinitions writes a TypeScript declaration file describing the
+// dbscript global and the row changes of the given tables.
+func WriteDefinitions(w io.Writer, tables []mysql.TableSchema) error {
+	var b strings.Builder
+
+	b.WriteString(definitionsHeader)
+	b.WriteString("\n  interface Tables {\n")
+
+	for _, table := range tables {
+		fmt.Fprintf(&b, "    %q: {\n", table.Database+"."+table.Table)
+		b.WriteString("      row: {\n")
+
+		for _, column := range table.Columns {
+			jsType := column.JSType
+			if column.Nullable {
+				jsType += " | null"
+			}
+
+			fmt.Fprintf(&b, "        /** %s */\n", column.RawType)
+			fmt.Fprintf(&b, "        %s: %s;\n", propertyName(column.Name), jsType)
+		}
+
+		b.WriteString("      };\n")
+		fmt.Fprintf(&b, "      change: RowChange<%q, %q, Tables[%q][\"row\"]>;\n", table.Database, table.Table, table.Database+"."+table.Table)
+		b.WriteString("    };\n")
+	}
+
+	b.WriteString("  }\n}\n\n")
+	b.WriteString("declare function require(specifier: string): any;\n")
+	b.WriteString("declare function fetch(url: string, options?: dbscript.FetchOptions): Promise<dbscript.FetchResponse>;\n")
+	b.WriteString("declare function setTimeout(callback: (...args: any[]) => void, ms?: number, ...args: any[]): number;\n")
+	b.WriteString("declare function clearTimeout(id: number): void;\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// propertyName quotes names that are not valid identifiers.
+func propertyName(name string) string {
+	if identifier.MatchString(name) {
+		return name
+	}
+
+	return fmt.Sprintf("%q", name)
+}
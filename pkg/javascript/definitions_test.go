@@ -0,0 +1,49 @@
+package javascript
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/JayJamieson/dbscript/pkg/mysql"
+	"github.com/evanw/esbuild/pkg/api"
+)
+
+func TestWriteDefinitions(t *testing.T) {
+	tables := []mysql.TableSchema{{
+		Database: "dbscript",
+		Table:    "user",
+		Columns: []mysql.ColumnSchema{
+			{Name: "id", RawType: "int", JSType: "number"},
+			{Name: "email", RawType: "varchar(255)", JSType: "string", Nullable: true},
+			{Name: "first-name", RawType: "text", JSType: "number[]"},
+		},
+	}}
+
+	var b strings.Builder
+	if err := WriteDefinitions(&b, tables); err != nil {
+		t.Fatalf("WriteDefinitions() error = %v", err)
+	}
+
+	definitions := b.String()
+
+	for _, expected := range []string{
+		`"dbscript.user": {`,
+		`id: number;`,
+		`email: string | null;`,
+		`"first-name": number[];`,
+		`change: RowChange<"dbscript", "user", Tables["dbscript.user"]["row"]>;`,
+		`info(msg: string, fields?: Record<string, unknown>): void;`,
+		`const log: Log;`,
+		`json(): unknown;`,
+		`declare function fetch(url: string, options?: dbscript.FetchOptions): Promise<dbscript.FetchResponse>;`,
+	} {
+		if !strings.Contains(definitions, expected) {
+			t.Errorf("definitions do not contain %q:\n%s", expected, definitions)
+		}
+	}
+
+	result := api.Transform(definitions, api.TransformOptions{Loader: api.LoaderTS})
+	if len(result.Errors) > 0 {
+		t.Errorf("definitions are not valid TypeScript: %v", result.Errors[0].Text)
+	}
+}
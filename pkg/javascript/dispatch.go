@@ -0,0 +1,127 @@
+package javascript
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/JayJamieson/dbscript/pkg/event"
+	"github.com/grafana/sobek"
+)
+
+const (
+	// handlersName is an optional global map of handlers keyed by table,
+	// used instead of handle.
+	handlersName = "handlers"
+
+	// anyTable is the handlers key used for tables without their own entry.
+	anyTable = "*"
+)
+
+// operations are the keys of a per-operation handlers entry, matching the
+// lower cased row change type.
+var operations = []string{"insert", "update", "delete"}
+
+// dispatch holds the handlers of a handlers map resolved per table and
+// operation.
+type dispatch struct {
+	tables map[string]map[string]sobek.Callable
+}
+
+// newDispatch resolves a handlers map such as
+//
+//	{ "dbscript.user": { insert, update }, "*": fallback }
+//
+// where an entry is a function handling every operation or an object of
+// insert, update and delete functions.
+func newDispatch(value sobek.Value) (*dispatch, error) {
+	obj, ok := value.(*sobek.Object)
+	if !ok {
+		return nil, fmt.Errorf("%s must be an object keyed by table", handlersName)
+	}
+
+	d := &dispatch{tables: make(map[string]map[string]sobek.Callable)}
+
+	for _, table := range obj.Keys() {
+		entry := obj.Get(table)
+
+		if fn, ok := sobek.AssertFunction(entry); ok {
+			d.tables[table] = make(map[string]sobek.Callable, len(operations))
+			for _, op := range operations {
+				d.tables[table][op] = fn
+			}
+			continue
+		}
+
+		entryObj, ok := entry.(*sobek.Object)
+		if !ok {
+			return nil, fmt.Errorf("%s[%q] must be a function or an object of %s functions", handlersName, table, strings.Join(operations, ", "))
+		}
+
+		d.tables[table] = make(map[string]sobek.Callable, len(operations))
+
+		for _, op := range entryObj.Keys() {
+			if !slices.Contains(operations, op) {
+				return nil, fmt.Errorf("%s[%q] has unknown operation %q, expected one of %s", handlersName, table, op, strings.Join(operations, ", "))
+			}
+
+			fn, ok := sobek.AssertFunction(entryObj.Get(op))
+			if !ok {
+				return nil, fmt.Errorf("%s[%q].%s is not a function", handlersName, table, op)
+			}
+
+			d.tables[table][op] = fn
+		}
+	}
+
+	return d, nil
+}
+
+// handler returns the handler of the operation on table, falling back to the
+// "*" entry.
+func (d *dispatch) handler(table, op string) (sobek.Callable, bool) {
+	if fn, ok := d.tables[table][op]; ok {
+		return fn, true
+	}
+
+	fn, ok := d.tables[anyTable][op]
+	return fn, ok
+}
+
+// check returns a *MissingTableHandlerError listing the operations of tables
+// no handler is resolved for.
+func (d *dispatch) check(tables []string) error {
+	missing := make(map[string][]string)
+
+	for _, table := range tables {
+		for _, op := range operations {
+			if _, ok := d.handler(table, op); !ok {
+				missing[table] = append(missing[table], op)
+			}
+		}
+	}
+
+	if len(missing) > 0 {
+		return &MissingTableHandlerError{Tables: missing}
+	}
+
+	return nil
+}
+
+// find returns the handler of a row change event.
+func (d *dispatch) find(e event.Event) (sobek.Callable, error) {
+	table := event.TableOf(e)
+
+	var op string
+	if payload, ok := e.Payload.(map[string]any); ok {
+		op, _ = payload["type"].(string)
+		op = strings.ToLower(op)
+	}
+
+	fn, ok := d.handler(table, op)
+	if !ok {
+		return nil, &MissingTableHandlerError{Tables: map[string][]string{table: {op}}}
+	}
+
+	return fn, nil
+}
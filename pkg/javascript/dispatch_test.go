@@ -0,0 +1,161 @@
+package javascript
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/JayJamieson/dbscript/pkg/event"
+	"github.com/JayJamieson/dbscript/pkg/mysql"
+)
+
+func createTableEvent(table, op string) event.Event {
+	return event.New(mysql.RowChangeEvent{
+		Source:   "default",
+		Database: "dbscript",
+		Table:    table,
+		Type:     op,
+	})
+}
+
+func TestHandlers(t *testing.T) {
+	script := `
+		function mark(name) {
+			return function (event) {
+				event.metadata.handler = name;
+				dbscript.ctx.ok(event);
+			};
+		}
+
+		var handlers = {
+			"dbscript.user": { insert: mark("user.insert"), update: mark("user.update") },
+			"dbscript.orders": mark("orders"),
+			"*": { update: mark("any.update"), delete: mark("any.delete") },
+		};
+	`
+
+	tests := []struct {
+		table    string
+		op       string
+		expected string
+	}{
+		{table: "user", op: "INSERT", expected: "user.insert"},
+		{table: "user", op: "UPDATE", expected: "user.update"},
+		{table: "user", op: "DELETE", expected: "any.delete"},
+		{table: "orders", op: "INSERT", expected: "orders"},
+		{table: "orders", op: "DELETE", expected: "orders"},
+		{table: "accounts", op: "UPDATE", expected: "any.update"},
+	}
+
+	js, err := New(Options{Name: "handler.js", Script: script})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.table+" "+tt.op, func(t *testing.T) {
+			outcome, err := js.Execute(createTableEvent(tt.table, tt.op))
+			if err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+
+			if handler := outcome.Event.Metadata["handler"]; handler != tt.expected {
+				t.Errorf("handler = %v, expected %v", handler, tt.expected)
+			}
+		})
+	}
+
+	_, err = js.Execute(createTableEvent("accounts", "INSERT"))
+
+	var missingErr *MissingTableHandlerError
+	if !errors.As(err, &missingErr) {
+		t.Fatalf("error = %T %v, expected *MissingTableHandlerError", err, err)
+	}
+
+	expected := map[string][]string{"dbscript.accounts": {"insert"}}
+	if !reflect.DeepEqual(missingErr.Tables, expected) {
+		t.Errorf("Tables = %v, expected %v", missingErr.Tables, expected)
+	}
+}
+
+func TestHandlersModule(t *testing.T) {
+	js, err := New(Options{Name: "handler.mjs", Tables: []string{"dbscript.user"}, Script: `
+		export const handlers = {
+			"dbscript.user": {
+				insert(event) { dbscript.ctx.drop("insert"); },
+				update(event) { dbscript.ctx.drop("update"); },
+				delete(event) { dbscript.ctx.drop("delete"); },
+			},
+		};
+	`})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	outcome, err := js.Execute(createTestEvent())
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	if outcome.Action != event.Drop || outcome.Reason != "update" {
+		t.Errorf("outcome = %v %q, expected drop %q", outcome.Action, outcome.Reason, "update")
+	}
+}
+
+func TestHandlersErrors(t *testing.T) {
+	tables := []string{"dbscript.user", "dbscript.orders", "dbscript.accounts"}
+
+	tests := []struct {
+		name     string
+		script   string
+		expected string
+	}{
+		{
+			name: "missing tables",
+			script: `var handlers = {
+				"dbscript.user": { insert: function () {}, update: function () {} },
+				"dbscript.accounts": function () {},
+			};`,
+			expected: "handlers has no handler for dbscript.orders (insert, update, delete), dbscript.user (delete)",
+		},
+		{
+			name:     "not an object",
+			script:   `var handlers = 42;`,
+			expected: "handlers must be an object keyed by table",
+		},
+		{
+			name:     "invalid entry",
+			script:   `var handlers = { "*": "nope" };`,
+			expected: `handlers["*"] must be a function or an object of insert, update, delete functions`,
+		},
+		{
+			name:     "unknown operation",
+			script:   `var handlers = { "*": { inserts: function () {} } };`,
+			expected: `handlers["*"] has unknown operation "inserts"`,
+		},
+		{
+			name:     "operation is not a function",
+			script:   `var handlers = { "*": { insert: 1 } };`,
+			expected: `handlers["*"].insert is not a function`,
+		},
+		{
+			name:     "handle and handlers",
+			script:   `function handle() {} var handlers = { "*": function () {} };`,
+			expected: "define either handle or handlers, not both",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(Options{Name: "handler.js", Script: tt.script, Tables: tables})
+			if err == nil {
+				t.Fatal("New() should fail")
+			}
+
+			if !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("error = %q, expected it to contain %q", err, tt.expected)
+			}
+		})
+	}
+}
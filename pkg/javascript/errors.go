@@ -0,0 +1,180 @@
+package javascript
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/grafana/sobek"
+	"github.com/grafana/sobek/parser"
+)
+
+// CompileError is returned when the script has a syntax or reference error.
+type CompileError struct {
+	File    string
+	Line    int
+	Column  int
+	Message string
+}
+
+func (e *CompileError) Error() string {
+	return fmt.Sprintf("compiling %s:%d:%d: %s", e.File, e.Line, e.Column, e.Message)
+}
+
+// MissingHandlerError is returned when the script does not define the
+// handler function.
+type MissingHandlerError struct {
+	Name string
+}
+
+func (e *MissingHandlerError) Error() string {
+	return fmt.Sprintf("%s is not defined or is not a function", e.Name)
+}
+
+// MissingTableHandlerError is returned when a handlers map has no handler for
+// operations of monitored tables, Tables maps "database.table" to the
+// operations missing.
+type MissingTableHandlerError struct {
+	Tables map[string][]string
+}
+
+func (e *MissingTableHandlerError) Error() string {
+	var tables []string
+	for _, table := range slices.Sorted(maps.Keys(e.Tables)) {
+		tables = append(tables, fmt.Sprintf("%s (%s)", table, strings.Join(e.Tables[table], ", ")))
+	}
+
+	return fmt.Sprintf("%s has no handler for %s", handlersName, strings.Join(tables, ", "))
+}
+
+// UnknownSinkError is thrown when a handler routes an event to a sink that is
+// not configured.
+type UnknownSinkError struct {
+	Name string
+}
+
+func (e *UnknownSinkError) Error() string {
+	return fmt.Sprintf("unknown sink %q", e.Name)
+}
+
+// ExceptionError is an uncaught JavaScript exception, Stack holds the JS
+// stack trace.
+type ExceptionError struct {
+	Message string
+	Stack   string
+
+	exception *sobek.Exception
+}
+
+func (e *ExceptionError) Error() string {
+	if e.Stack == "" {
+		return "uncaught exception: " + e.Message
+	}
+
+	return fmt.Sprintf("uncaught exception: %s\n%s", e.Message, e.Stack)
+}
+
+func (e *ExceptionError) Unwrap() error {
+	// rejections and module errors carry no exception
+	if e.exception == nil {
+		return nil
+	}
+
+	return e.exception
+}
+
+// TimeoutError is returned when a handler exceeds its execution budget.
+type TimeoutError struct {
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("handler exceeded its %s execution timeout", e.Timeout)
+}
+
+// newCompileError converts parser and compiler errors into a CompileError
+// with a line and column.
+func newCompileError(name string, err error) error {
+	var parseErrs parser.ErrorList
+	var parseErr *parser.Error
+
+	if errors.As(err, &parseErrs) && len(parseErrs) > 0 {
+		parseErr = parseErrs[0]
+	}
+
+	if parseErr != nil || errors.As(err, &parseErr) {
+		return &CompileError{
+			File:    name,
+			Line:    parseErr.Position.Line,
+			Column:  parseErr.Position.Column,
+			Message: parseErr.Message,
+		}
+	}
+
+	var syntaxErr *sobek.CompilerSyntaxError
+	var referenceErr *sobek.CompilerReferenceError
+	var compilerErr *sobek.CompilerError
+
+	switch {
+	case errors.As(err, &syntaxErr):
+		compilerErr = &syntaxErr.CompilerError
+	case errors.As(err, &referenceErr):
+		compilerErr = &referenceErr.CompilerError
+	default:
+		return &CompileError{File: name, Message: err.Error()}
+	}
+
+	compileErr := &CompileError{File: name, Message: compilerErr.Message}
+
+	if compilerErr.File != nil {
+		pos := compilerErr.File.Position(compilerErr.Offset)
+		compileErr.Line = pos.Line
+		compileErr.Column = pos.Column
+	}
+
+	return compileErr
+}
+
+// wrapRuntimeError converts errors returned by sobek while running script
+// code into typed errors.
+func wrapRuntimeError(err error, timeout time.Duration) error {
+	var exception *sobek.Exception
+	var interrupted *sobek.InterruptedError
+
+	switch {
+	case errors.As(err, &exception):
+		return newExceptionError(exception)
+	case errors.As(err, &interrupted):
+		var timeoutErr *TimeoutError
+		if errors.As(interrupted, &timeoutErr) {
+			return timeoutErr
+		}
+		return &TimeoutError{Timeout: timeout}
+	default:
+		return err
+	}
+}
+
+func newExceptionError(exception *sobek.Exception) *ExceptionError {
+	message := exception.Error()
+	if value := exception.Value(); value != nil {
+		message = value.String()
+	}
+
+	var stack bytes.Buffer
+	for _, frame := range exception.Stack() {
+		stack.WriteString("\tat ")
+		frame.Write(&stack)
+		stack.WriteString("\n")
+	}
+
+	return &ExceptionError{
+		Message:   message,
+		Stack:     strings.TrimRight(stack.String(), "\n"),
+		exception: exception,
+	}
+}
@@ -0,0 +1,159 @@
+package javascript
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		check  func(t *testing.T, err error)
+	}{
+		{
+			name:   "syntax error",
+			script: "function handle() {\n  var x = ;\n}",
+			check: func(t *testing.T, err error) {
+				var compileErr *CompileError
+				if !errors.As(err, &compileErr) {
+					t.Fatalf("error = %T %v, expected *CompileError", err, err)
+				}
+				if compileErr.File != "handler.js" {
+					t.Errorf("File = %q, expected %q", compileErr.File, "handler.js")
+				}
+				if compileErr.Line != 2 {
+					t.Errorf("Line = %d, expected 2", compileErr.Line)
+				}
+				if compileErr.Column == 0 {
+					t.Errorf("Column should be set")
+				}
+			},
+		},
+		{
+			name:   "missing handler",
+			script: "function handler() {}",
+			check: func(t *testing.T, err error) {
+				var missingErr *MissingHandlerError
+				if !errors.As(err, &missingErr) {
+					t.Fatalf("error = %T %v, expected *MissingHandlerError", err, err)
+				}
+			},
+		},
+		{
+			name:   "handler is not a function",
+			script: "var handle = 42;",
+			check: func(t *testing.T, err error) {
+				var missingErr *MissingHandlerError
+				if !errors.As(err, &missingErr) {
+					t.Fatalf("error = %T %v, expected *MissingHandlerError", err, err)
+				}
+			},
+		},
+		{
+			name:   "exception while loading",
+			script: "throw new Error('boom');\nfunction handle() {}",
+			check: func(t *testing.T, err error) {
+				var exceptionErr *ExceptionError
+				if !errors.As(err, &exceptionErr) {
+					t.Fatalf("error = %T %v, expected *ExceptionError", err, err)
+				}
+				if !strings.Contains(exceptionErr.Message, "boom") {
+					t.Errorf("Message = %q, expected to contain %q", exceptionErr.Message, "boom")
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			js, err := New(Options{Name: "handler.js", Script: tt.script})
+			if err == nil {
+				t.Fatalf("New() = %v, expected error", js)
+			}
+			tt.check(t, err)
+		})
+	}
+}
+
+func TestExecuteException(t *testing.T) {
+	js, err := New(Options{Name: "handler.js", Script: `
+function validate(event) {
+  throw new Error("invalid email " + event.payload.after.email);
+}
+
+function handle(event) {
+  validate(event);
+}
+`})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	_, err = js.Execute(createTestEvent())
+
+	var exceptionErr *ExceptionError
+	if !errors.As(err, &exceptionErr) {
+		t.Fatalf("Execute() error = %T %v, expected *ExceptionError", err, err)
+	}
+
+	if !strings.Contains(exceptionErr.Message, "invalid email john.doe@example.com") {
+		t.Errorf("Message = %q", exceptionErr.Message)
+	}
+
+	if !strings.Contains(exceptionErr.Stack, "validate (handler.js:3") || !strings.Contains(exceptionErr.Stack, "handle (handler.js:7") {
+		t.Errorf("Stack = %q, expected validate and handle frames", exceptionErr.Stack)
+	}
+
+	// the VM stays usable after an exception
+	if _, err := js.Execute(createTestEvent()); !errors.As(err, &exceptionErr) {
+		t.Errorf("second Execute() error = %v, expected *ExceptionError", err)
+	}
+}
+
+func TestExecuteTimeout(t *testing.T) {
+	js, err := New(Options{
+		Script: `function handle(event) {
+			if (event.payload.table === "user") {
+				while (true) {}
+			}
+		}`,
+		Timeout: 50 * time.Millisecond,
+		TableTimeouts: map[string]time.Duration{
+			"dbscript.user": 10 * time.Millisecond,
+		},
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	_, err = js.Execute(createTestEvent())
+
+	var timeoutErr *TimeoutError
+	if !errors.As(err, &timeoutErr) {
+		t.Fatalf("Execute() error = %T %v, expected *TimeoutError", err, err)
+	}
+
+	if timeoutErr.Timeout != 10*time.Millisecond {
+		t.Errorf("Timeout = %v, expected table timeout %v", timeoutErr.Timeout, 10*time.Millisecond)
+	}
+
+	// the interrupt is cleared so the next event runs normally
+	other := createTestEvent()
+	other.Payload.(map[string]any)["table"] = "events"
+
+	if _, err := js.Execute(other); err != nil {
+		t.Errorf("Execute() after timeout error = %v", err)
+	}
+}
+
+func TestNewTimeout(t *testing.T) {
+	_, err := New(Options{Script: "while (true) {}", Timeout: 10 * time.Millisecond})
+
+	var timeoutErr *TimeoutError
+	if !errors.As(err, &timeoutErr) {
+		t.Fatalf("New() error = %T %v, expected *TimeoutError", err, err)
+	}
+}
@@ -0,0 +1,188 @@
+package javascript
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/grafana/sobek"
+)
+
+// UnhandledRejectionError is returned when a promise created by an invocation
+// was rejected without a handler.
+type UnhandledRejectionError struct {
+	Message string
+	Stack   string
+}
+
+func (e *UnhandledRejectionError) Error() string {
+	if e.Stack == "" {
+		return "unhandled promise rejection: " + e.Message
+	}
+
+	return fmt.Sprintf("unhandled promise rejection: %s\n%s", e.Message, e.Stack)
+}
+
+// eventLoop runs the timers of a VM and tracks rejected promises. Promise
+// jobs run whenever a call into the VM returns, the loop only waits for
+// timers until the promise returned by a handler settles.
+type eventLoop struct {
+	vm     *sobek.Runtime
+	timers map[int64]*timer
+	nextID int64
+
+	// rejected are the rejected promises without a handler in order
+	rejected []*sobek.Promise
+}
+
+type timer struct {
+	id   int64
+	due  time.Time
+	fn   sobek.Callable
+	args []sobek.Value
+}
+
+func newEventLoop(vm *sobek.Runtime) *eventLoop {
+	l := &eventLoop{vm: vm, timers: make(map[int64]*timer)}
+
+	vm.SetPromiseRejectionTracker(func(p *sobek.Promise, operation sobek.PromiseRejectionOperation) {
+		switch operation {
+		case sobek.PromiseRejectionReject:
+			l.rejected = append(l.rejected, p)
+		case sobek.PromiseRejectionHandle:
+			for i, rejected := range l.rejected {
+				if rejected == p {
+					l.rejected = append(l.rejected[:i], l.rejected[i+1:]...)
+					break
+				}
+			}
+		}
+	})
+
+	return l
+}
+
+// install defines setTimeout and clearTimeout.
+func (l *eventLoop) install() error {
+	global := l.vm.GlobalObject()
+
+	if err := global.Set("setTimeout", l.setTimeout); err != nil {
+		return err
+	}
+
+	return global.Set("clearTimeout", l.clearTimeout)
+}
+
+// setTimeout schedules fn after delay milliseconds with the remaining
+// arguments and returns the timer id.
+func (l *eventLoop) setTimeout(call sobek.FunctionCall) sobek.Value {
+	fn, ok := sobek.AssertFunction(call.Argument(0))
+	if !ok {
+		panic(l.vm.NewTypeError("setTimeout callback must be a function"))
+	}
+
+	delay := max(call.Argument(1).ToInteger(), 0)
+
+	var args []sobek.Value
+	if len(call.Arguments) > 2 {
+		args = append(args, call.Arguments[2:]...)
+	}
+
+	l.nextID++
+	l.timers[l.nextID] = &timer{
+		id:   l.nextID,
+		due:  time.Now().Add(time.Duration(delay) * time.Millisecond),
+		fn:   fn,
+		args: args,
+	}
+
+	return l.vm.ToValue(l.nextID)
+}
+
+func (l *eventLoop) clearTimeout(id int64) {
+	delete(l.timers, id)
+}
+
+// next returns the timer due first, timers due at the same time run in the
+// order they were created.
+func (l *eventLoop) next() *timer {
+	var next *timer
+
+	for _, t := range l.timers {
+		if next == nil || t.due.Before(next.due) || (t.due.Equal(next.due) && t.id < next.id) {
+			next = t
+		}
+	}
+
+	return next
+}
+
+// wait runs timers until result settles when it is a promise and returns an
+// error when it was rejected, when it cannot settle or when a promise was
+// rejected without a handler. Waiting never goes past deadline, callers
+// reset the loop afterwards to cancel the timers left.
+func (l *eventLoop) wait(result sobek.Value, deadline time.Time, timeout time.Duration) error {
+	var promise *sobek.Promise
+	if result != nil {
+		promise, _ = result.Export().(*sobek.Promise)
+	}
+
+	for promise != nil && promise.State() == sobek.PromiseStatePending {
+		next := l.next()
+		if next == nil {
+			return errors.New("handler returned a promise that never settles")
+		}
+
+		if !deadline.IsZero() && next.due.After(deadline) {
+			time.Sleep(time.Until(deadline))
+			return &TimeoutError{Timeout: timeout}
+		}
+
+		time.Sleep(time.Until(next.due))
+		delete(l.timers, next.id)
+
+		if _, err := next.fn(sobek.Undefined(), next.args...); err != nil {
+			return err
+		}
+	}
+
+	if promise != nil && promise.State() == sobek.PromiseStateRejected {
+		return rejectionError(promise.Result())
+	}
+
+	for _, rejected := range l.rejected {
+		if rejected != promise {
+			err := rejectionError(rejected.Result())
+			return &UnhandledRejectionError{Message: err.Message, Stack: err.Stack}
+		}
+	}
+
+	return nil
+}
+
+// reset cancels the timers and forgets the rejections of an invocation.
+func (l *eventLoop) reset() {
+	clear(l.timers)
+	l.rejected = nil
+}
+
+// rejectionError converts the reason a promise was rejected with, keeping
+// the stack of Error objects.
+func rejectionError(reason sobek.Value) *ExceptionError {
+	if reason == nil {
+		return &ExceptionError{Message: "promise rejected"}
+	}
+
+	err := &ExceptionError{Message: reason.String()}
+
+	if obj, ok := reason.(*sobek.Object); ok {
+		if stack := obj.Get("stack"); stack != nil && !sobek.IsUndefined(stack) {
+			// the first line repeats the message
+			_, frames, _ := strings.Cut(stack.String(), "\n")
+			err.Stack = strings.TrimRight(frames, "\n")
+		}
+	}
+
+	return err
+}
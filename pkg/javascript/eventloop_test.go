@@ -0,0 +1,123 @@
+package javascript
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JayJamieson/dbscript/pkg/event"
+)
+
+func TestAsyncHandler(t *testing.T) {
+	js, err := New(Options{
+		Timeout: time.Second,
+		Script: `
+			var order = [];
+
+			function sleep(ms, value) {
+				return new Promise(function (resolve) { setTimeout(resolve, ms, value); });
+			}
+
+			async function init() {
+				order.push(await sleep(5, "init"));
+			}
+
+			async function handle(event) {
+				var cancelled = setTimeout(function () { order.push("cancelled"); }, 1);
+				clearTimeout(cancelled);
+
+				setTimeout(function () { order.push("second"); }, 10);
+				setTimeout(function () { order.push("first"); }, 5);
+
+				await sleep(20);
+				event.metadata.order = order.join(",");
+				dbscript.ctx.drop("done");
+			}
+		`,
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	outcome, err := js.Execute(createTestEvent())
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	if outcome.Action != event.Drop {
+		t.Errorf("Action = %v, expected Drop", outcome.Action)
+	}
+
+	if order := outcome.Event.Metadata["order"]; order != "init,first,second" {
+		t.Errorf("order = %v, expected init,first,second", order)
+	}
+}
+
+func TestAsyncHandlerErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		check  func(err error) bool
+	}{
+		{
+			name:   "rejected",
+			script: `async function handle() { await null; throw new Error("lookup failed"); }`,
+			check: func(err error) bool {
+				var exception *ExceptionError
+				return errors.As(err, &exception) && strings.Contains(exception.Message, "lookup failed")
+			},
+		},
+		{
+			name:   "unhandled rejection",
+			script: `function handle() { Promise.reject(new Error("forgotten")); }`,
+			check: func(err error) bool {
+				var rejection *UnhandledRejectionError
+				return errors.As(err, &rejection) && strings.Contains(rejection.Message, "forgotten")
+			},
+		},
+		{
+			name:   "timer exceeds timeout",
+			script: `function handle() { return new Promise(function (resolve) { setTimeout(resolve, 5000); }); }`,
+			check: func(err error) bool {
+				var timeoutErr *TimeoutError
+				return errors.As(err, &timeoutErr)
+			},
+		},
+		{
+			name:   "never settles",
+			script: `function handle() { return new Promise(function () {}); }`,
+			check: func(err error) bool {
+				return err != nil && strings.Contains(err.Error(), "never settles")
+			},
+		},
+		{
+			name:   "timer throws",
+			script: `function handle() { return new Promise(function () { setTimeout(function () { throw new Error("in timer"); }, 1); }); }`,
+			check: func(err error) bool {
+				var exception *ExceptionError
+				return errors.As(err, &exception) && strings.Contains(exception.Message, "in timer")
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			js, err := New(Options{Timeout: 50 * time.Millisecond, Script: tt.script})
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			start := time.Now()
+			_, err = js.Execute(createTestEvent())
+
+			if !tt.check(err) {
+				t.Errorf("Execute() error = %T %v", err, err)
+			}
+
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("Execute() took %s, expected it to be bounded by the timeout", elapsed)
+			}
+		})
+	}
+}
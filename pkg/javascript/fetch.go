@@ -0,0 +1,300 @@
+package javascript
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/grafana/sobek"
+)
+
+const (
+	// DefaultFetchTimeout is the budget of a single fetch attempt.
+	DefaultFetchTimeout = 5 * time.Second
+
+	// DefaultFetchMaxResponseBytes caps the size of response bodies.
+	DefaultFetchMaxResponseBytes = 1 << 20
+
+	defaultFetchRetryDelay = 100 * time.Millisecond
+)
+
+// FetchOptions configures the fetch global. Requests are only allowed to
+// AllowedHosts, with no hosts fetch always fails.
+type FetchOptions struct {
+	// AllowedHosts are host names or *.domain wildcards matching any
+	// subdomain.
+	AllowedHosts []string
+
+	// Timeout bounds each attempt, requests never outlive the handler
+	// execution timeout.
+	Timeout time.Duration
+
+	MaxResponseBytes int64
+
+	// Retries is how many times requests failing with a network error or a
+	// 429, 502, 503 or 504 status are retried, scripts may override it.
+	Retries    int
+	RetryDelay time.Duration
+
+	// Client defaults to a client without a global timeout.
+	Client *http.Client
+}
+
+// FetchError is returned for requests that fail or are not allowed.
+type FetchError struct {
+	URL     string
+	Message string
+}
+
+func (e *FetchError) Error() string {
+	return fmt.Sprintf("fetch %s: %s", e.URL, e.Message)
+}
+
+// fetchRequest is the optional second argument of fetch.
+type fetchRequest struct {
+	Method  string            `json:"method"`
+	Headers map[string]string `json:"headers"`
+	Body    string            `json:"body"`
+
+	// Timeout and RetryDelay are in milliseconds like setTimeout.
+	Timeout    *int64 `json:"timeout"`
+	Retries    *int   `json:"retries"`
+	RetryDelay *int64 `json:"retryDelay"`
+}
+
+// fetchResponse is what the promise returned by fetch resolves to.
+type fetchResponse struct {
+	URL        string            `json:"url"`
+	Status     int               `json:"status"`
+	StatusText string            `json:"statusText"`
+	Ok         bool              `json:"ok"`
+	Headers    map[string]string `json:"headers"`
+
+	body []byte
+}
+
+// Text returns the body as a string.
+func (r *fetchResponse) Text() string {
+	return string(r.body)
+}
+
+// Json parses the body as JSON.
+func (r *fetchResponse) Json() (any, error) {
+	var value any
+	if err := json.Unmarshal(r.body, &value); err != nil {
+		return nil, &FetchError{URL: r.URL, Message: "invalid JSON body: " + err.Error()}
+	}
+
+	return value, nil
+}
+
+type fetcher struct {
+	js      *JavaScript
+	options FetchOptions
+	client  *http.Client
+}
+
+func newFetcher(js *JavaScript, options FetchOptions) *fetcher {
+	if options.Timeout <= 0 {
+		options.Timeout = DefaultFetchTimeout
+	}
+
+	if options.MaxResponseBytes <= 0 {
+		options.MaxResponseBytes = DefaultFetchMaxResponseBytes
+	}
+
+	if options.RetryDelay <= 0 {
+		options.RetryDelay = defaultFetchRetryDelay
+	}
+
+	f := &fetcher{js: js, options: options}
+
+	client := options.Client
+	if client == nil {
+		client = &http.Client{}
+	}
+
+	// copy the client to check redirects against the allowlist as well
+	checked := *client
+	checked.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if err := f.allowed(req.URL); err != nil {
+			return err
+		}
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		return nil
+	}
+	f.client = &checked
+
+	return f
+}
+
+// allowed checks the URL scheme and host against the allowlist.
+func (f *fetcher) allowed(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return &FetchError{URL: u.String(), Message: "only http and https URLs are supported"}
+	}
+
+	host := strings.ToLower(u.Hostname())
+
+	for _, allowed := range f.options.AllowedHosts {
+		allowed = strings.ToLower(allowed)
+
+		if suffix, ok := strings.CutPrefix(allowed, "*."); ok {
+			if strings.HasSuffix(host, "."+suffix) {
+				return nil
+			}
+		} else if host == allowed {
+			return nil
+		}
+	}
+
+	return &FetchError{URL: u.String(), Message: fmt.Sprintf("host %q is not allowed", host)}
+}
+
+// fetch implements the fetch global. The request runs to completion before
+// fetch returns a settled promise.
+func (f *fetcher) fetch(call sobek.FunctionCall) sobek.Value {
+	vm := f.js.vm
+	promise, resolve, reject := vm.NewPromise()
+
+	response, err := f.do(call)
+
+	if err != nil {
+		_ = reject(vm.NewGoError(err))
+	} else {
+		_ = resolve(response)
+	}
+
+	return vm.ToValue(promise)
+}
+
+func (f *fetcher) do(call sobek.FunctionCall) (*fetchResponse, error) {
+	rawURL := call.Argument(0).String()
+
+	var req fetchRequest
+	if arg := call.Argument(1); !sobek.IsUndefined(arg) && !sobek.IsNull(arg) {
+		if err := f.js.vm.ExportTo(arg, &req); err != nil {
+			return nil, &FetchError{URL: rawURL, Message: "invalid options: " + err.Error()}
+		}
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, &FetchError{URL: rawURL, Message: err.Error()}
+	}
+
+	if err := f.allowed(u); err != nil {
+		return nil, err
+	}
+
+	method := strings.ToUpper(req.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	timeout := f.options.Timeout
+	if req.Timeout != nil {
+		timeout = time.Duration(*req.Timeout) * time.Millisecond
+	}
+
+	retries := f.options.Retries
+	if req.Retries != nil {
+		retries = *req.Retries
+	}
+
+	retryDelay := f.options.RetryDelay
+	if req.RetryDelay != nil {
+		retryDelay = time.Duration(*req.RetryDelay) * time.Millisecond
+	}
+
+	// requests count against the execution timeout of the invocation
+	ctx := context.Background()
+	if !f.js.deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, f.js.deadline)
+		defer cancel()
+	}
+
+	for attempt := 0; ; attempt++ {
+		response, retry, err := f.attempt(ctx, method, u, req, timeout)
+
+		if !retry || attempt >= retries {
+			return response, err
+		}
+
+		select {
+		case <-time.After(retryDelay << attempt):
+		case <-ctx.Done():
+			return nil, &FetchError{URL: u.String(), Message: ctx.Err().Error()}
+		}
+	}
+}
+
+// attempt sends the request once, retry reports whether it may be retried.
+func (f *fetcher) attempt(ctx context.Context, method string, u *url.URL, req fetchRequest, timeout time.Duration) (*fetchResponse, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var body io.Reader
+	if req.Body != "" {
+		body = strings.NewReader(req.Body)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, false, &FetchError{URL: u.String(), Message: err.Error()}
+	}
+
+	for name, value := range req.Headers {
+		httpReq.Header.Set(name, value)
+	}
+
+	httpResp, err := f.client.Do(httpReq)
+	if err != nil {
+		var fetchErr *FetchError
+		if errors.As(err, &fetchErr) {
+			return nil, false, fetchErr
+		}
+		return nil, true, &FetchError{URL: u.String(), Message: err.Error()}
+	}
+
+	defer httpResp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(httpResp.Body, f.options.MaxResponseBytes+1))
+	if err != nil {
+		return nil, true, &FetchError{URL: u.String(), Message: err.Error()}
+	}
+
+	if int64(len(data)) > f.options.MaxResponseBytes {
+		return nil, false, &FetchError{URL: u.String(), Message: fmt.Sprintf("response exceeds %d bytes", f.options.MaxResponseBytes)}
+	}
+
+	headers := make(map[string]string, len(httpResp.Header))
+	for name, values := range httpResp.Header {
+		headers[strings.ToLower(name)] = strings.Join(values, ", ")
+	}
+
+	response := &fetchResponse{
+		URL:        httpResp.Request.URL.String(),
+		Status:     httpResp.StatusCode,
+		StatusText: http.StatusText(httpResp.StatusCode),
+		Ok:         httpResp.StatusCode >= 200 && httpResp.StatusCode < 300,
+		Headers:    headers,
+		body:       data,
+	}
+
+	switch httpResp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return response, true, nil
+	}
+
+	return response, false, nil
+}
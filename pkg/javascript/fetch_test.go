@@ -0,0 +1,206 @@
+package javascript
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fetchHandler runs a handler storing the result of the promise returned by
+// fetch, or its rejection, in metadata.
+func fetchHandler(t *testing.T, options FetchOptions, timeout time.Duration, call string) (map[string]any, error) {
+	t.Helper()
+
+	js, err := New(Options{
+		Timeout: timeout,
+		Fetch:   options,
+		Script: `
+			function handle(event) {
+				` + call + `
+					.then(function (result) { event.metadata.result = result; })
+					.catch(function (err) { event.metadata.error = String(err); });
+			}
+		`,
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	outcome, err := js.Execute(createTestEvent())
+	if err != nil {
+		return nil, err
+	}
+
+	return outcome.Event.Metadata, nil
+}
+
+func TestFetch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/tier":
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"user_id": %q, "tier": "gold", "method": %q, "token": %q}`,
+				r.URL.Query().Get("user_id"), r.Method, r.Header.Get("Authorization"))
+		case "/large":
+			fmt.Fprint(w, strings.Repeat("x", 256))
+		case "/redirect":
+			http.Redirect(w, r, "http://example.com/", http.StatusFound)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL)
+	allowed := FetchOptions{AllowedHosts: []string{u.Hostname()}, MaxResponseBytes: 128}
+
+	tests := []struct {
+		name     string
+		options  FetchOptions
+		call     string
+		expected any
+		err      string
+	}{
+		{
+			name:     "json body",
+			options:  allowed,
+			call:     `fetch("` + server.URL + `/tier?user_id=1").then(function (r) { return r.json().tier; })`,
+			expected: "gold",
+		},
+		{
+			name:     "method and headers",
+			options:  allowed,
+			call:     `fetch("` + server.URL + `/tier", { method: "post", headers: { Authorization: "secret" } }).then(function (r) { var b = r.json(); return b.method + " " + b.token; })`,
+			expected: "POST secret",
+		},
+		{
+			name:     "status",
+			options:  allowed,
+			call:     `fetch("` + server.URL + `/missing").then(function (r) { return r.status + " " + r.ok; })`,
+			expected: "404 false",
+		},
+		{
+			name:     "response headers",
+			options:  allowed,
+			call:     `fetch("` + server.URL + `/tier").then(function (r) { return r.headers["content-type"]; })`,
+			expected: "application/json",
+		},
+		{
+			name:    "host not allowed",
+			options: FetchOptions{AllowedHosts: []string{"*.internal"}},
+			call:    `fetch("` + server.URL + `/tier")`,
+			err:     "is not allowed",
+		},
+		{
+			name:    "redirect to a host not allowed",
+			options: allowed,
+			call:    `fetch("` + server.URL + `/redirect")`,
+			err:     `host "example.com" is not allowed`,
+		},
+		{
+			name:    "response too large",
+			options: allowed,
+			call:    `fetch("` + server.URL + `/large")`,
+			err:     "response exceeds 128 bytes",
+		},
+		{
+			name:    "unsupported scheme",
+			options: allowed,
+			call:    `fetch("file:///etc/passwd")`,
+			err:     "only http and https",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metadata, err := fetchHandler(t, tt.options, 0, tt.call)
+			if err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+
+			if tt.err != "" {
+				if msg, _ := metadata["error"].(string); !strings.Contains(msg, tt.err) {
+					t.Errorf("error = %v, expected it to contain %q", metadata["error"], tt.err)
+				}
+				return
+			}
+
+			if metadata["result"] != tt.expected {
+				t.Errorf("result = %v, expected %v (error %v)", metadata["result"], tt.expected, metadata["error"])
+			}
+		})
+	}
+}
+
+func TestFetchRetries(t *testing.T) {
+	var requests atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, "ok")
+	}))
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL)
+	options := FetchOptions{AllowedHosts: []string{u.Hostname()}, RetryDelay: time.Millisecond}
+
+	tests := []struct {
+		name     string
+		retries  int
+		expected any
+	}{
+		{"without retries", 0, int64(503)},
+		{"with retries", 2, int64(200)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests.Store(0)
+
+			call := fmt.Sprintf(`fetch(%q, { retries: %d }).then(function (r) { return r.status; })`, server.URL, tt.retries)
+
+			metadata, err := fetchHandler(t, options, 0, call)
+			if err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+
+			if metadata["result"] != tt.expected {
+				t.Errorf("status = %v, expected %v", metadata["result"], tt.expected)
+			}
+		})
+	}
+}
+
+func TestFetchCountsAgainstTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(2 * time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL)
+	options := FetchOptions{AllowedHosts: []string{u.Hostname()}, Timeout: time.Minute}
+
+	start := time.Now()
+	_, err := fetchHandler(t, options, 50*time.Millisecond, `fetch("`+server.URL+`")`)
+
+	var timeoutErr *TimeoutError
+	if !errors.As(err, &timeoutErr) {
+		t.Fatalf("Execute() error = %T %v, expected *TimeoutError", err, err)
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Execute() took %s, expected the request to be cancelled at the handler timeout", elapsed)
+	}
+}
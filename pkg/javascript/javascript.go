@@ -2,78 +2,512 @@ package javascript
 
 import (
 	"fmt"
-	"os"
+	"log/slog"
+	"path/filepath"
+	"slices"
 	"time"
 
+	"github.com/JayJamieson/dbscript/pkg/event"
+	"github.com/JayJamieson/dbscript/pkg/state"
 	"github.com/grafana/sobek"
+	"github.com/grafana/sobek/ast"
+	"github.com/grafana/sobek/parser"
 )
 
+const (
+	// handlerName is the global function called for every event.
+	handlerName = "handle"
+
+	// initName is an optional global function called once after the script
+	// is loaded.
+	initName = "init"
+
+	// batchHandlerName is an optional global function called with an array
+	// of events by ExecuteBatch.
+	batchHandlerName = "handleBatch"
+
+	// shutdownName is an optional global function called by Shutdown.
+	shutdownName = "shutdown"
+)
+
+// JavaScript is a handler script compiled once and loaded into a prepared VM.
+// Calls to Execute only inject the event and invoke the cached handle
+// function. A VM is single threaded, Execute must not be called concurrently.
 type JavaScript struct {
-	options Options
-	vm      *sobek.Runtime
+	options     Options
+	vm          *sobek.Runtime
+	program     *sobek.Program
+	handle      sobek.Callable
+	handlers    *dispatch
+	handleBatch sobek.Callable
+	shutdown    sobek.Callable
+	runtime     *Runtime
+	modules     *modules
+	loop        *eventLoop
+	log         *handlerLog
+
+	// deadline is when the running invocation times out, zero without a
+	// timeout
+	deadline time.Time
 }
 
 type Options struct {
-	Script  string
+	// Name is the script file name used in compile errors and stack traces.
+	Name   string
+	Script string
+
+	// Timeout is the execution budget of a single handler invocation, the VM
+	// is interrupted when exceeded. Zero disables the timeout.
 	Timeout time.Duration
+
+	// TableTimeouts overrides Timeout for events of a table keyed by
+	// "database.table".
+	TableTimeouts map[string]time.Duration
+
+	// Lag reports the replication lag of a source, exposed to scripts as
+	// dbscript.lag(source).
+	Lag func(source string) any
+
+	// Logger receives console and dbscript.log messages, slog.Default when
+	// nil. LogLimit caps the messages logged per invocation, zero uses
+	// DefaultLogLimit and a negative value disables the limit.
+	Logger   *slog.Logger
+	LogLimit int
+
+	// Fetch configures the fetch global.
+	Fetch FetchOptions
+
+	// State backs dbscript.state, calls throw when nil.
+	State *state.Store
+
+	// DB configures dbscript.db.
+	DB DBOptions
+
+	// Sinks are the names of the sinks handlers may route events to, other
+	// names are handler errors.
+	Sinks []string
+
+	// Tables are the monitored tables as "database.table", scripts exporting
+	// a handlers map must handle every operation on each of them.
+	Tables []string
+
+	// Config is passed to init and exposed read-only as dbscript.config, it
+	// must be JSON encodable.
+	Config map[string]any
 }
 
-func New(options Options) *JavaScript {
+// New compiles the script, runs it once to define its functions, resolves
+// the handle function or handlers map and the handleBatch function and calls
+// the optional init function with Options.Config. Failures are returned as a *CompileError,
+// *ExceptionError, *TimeoutError, *UnhandledRejectionError,
+// *MissingHandlerError, *MissingTableHandlerError, *ModuleNotFoundError or
+// *ModuleCycleError.
+//
+// Scripts using import or export, or named *.mjs, are loaded as ES modules
+// and may export handle, handlers, handleBatch, init and shutdown instead of
+// defining them globally. Scripts are transpiled first, TypeScript types are
+// stripped and syntax the VM does not support is lowered.
+func New(options Options) (*JavaScript, error) {
 	vm := sobek.New()
+	vm.SetFieldNameMapper(sobek.TagFieldNameMapper("json", true))
 
-	return &JavaScript{
+	log := newHandlerLog(options.Logger, options.Name, options.LogLimit)
+
+	sinks := make(map[string]bool, len(options.Sinks))
+	for _, name := range options.Sinks {
+		sinks[name] = true
+	}
+
+	js := &JavaScript{
 		vm:      vm,
 		options: options,
+		log:     log,
+		runtime: &Runtime{
+			Context: runtimeCtx{sinks: sinks},
+			Log:     &Logger{log: log},
+			State:   &State{store: options.State},
+			lag:     options.Lag,
+		},
+	}
+
+	js.runtime.DB = newDB(js, options.DB)
+	js.loop = newEventLoop(vm)
+
+	if err := js.loop.install(); err != nil {
+		return nil, err
+	}
+
+	config, err := frozenConfig(vm, options.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	js.runtime.Config = config
+
+	if err := js.vm.GlobalObject().Set("dbscript", js.runtime); err != nil {
+		return nil, err
+	}
+
+	if err := js.vm.GlobalObject().Set("console", &console{log: log}); err != nil {
+		return nil, err
+	}
+
+	if err := js.vm.GlobalObject().Set("fetch", newFetcher(js, options.Fetch).fetch); err != nil {
+		return nil, err
 	}
+
+	js.modules = newModules(js, options.Name)
+
+	if err := js.modules.install(); err != nil {
+		return nil, err
+	}
+
+	// state written while loading and in init is not tied to a source
+	js.runtime.State.begin("")
+
+	if err := js.init(); err != nil {
+		js.runtime.State.end(false)
+		return nil, err
+	}
+
+	js.runtime.State.end(true)
+
+	return js, nil
 }
 
-func (js *JavaScript) Execute() error {
+// init loads the script, resolves the handle function or handlers map and
+// the lifecycle hooks and calls init with the config.
+func (js *JavaScript) init() error {
+	exports, err := js.load()
+	if err != nil {
+		return err
+	}
 
-	js.vm.SetFieldNameMapper(sobek.TagFieldNameMapper("json", true))
+	if err := js.resolve(exports); err != nil {
+		return err
+	}
 
-	js.vm.GlobalObject().Set("dbscript", &Runtime{
-		Context: runtimeCtx{},
-	})
+	// timers set while loading never run, rejections are still reported
+	err = js.loop.wait(nil, time.Time{}, js.options.Timeout)
+	js.loop.reset()
 
-	program, err := sobek.Compile("", js.options.Script, false)
+	if err != nil {
+		return err
+	}
+
+	js.shutdown, _ = sobek.AssertFunction(js.lookup(exports, shutdownName))
+
+	if initFn, ok := sobek.AssertFunction(js.lookup(exports, initName)); ok {
+		if err := js.call(initFn, js.runtime.Config, js.options.Timeout); err != nil {
+			return wrapRuntimeError(err, js.options.Timeout)
+		}
+	}
 
+	return nil
+}
+
+// load compiles and runs the script, returning the exports of an ES module
+// and nil for a plain script.
+func (js *JavaScript) load() (*sobek.Object, error) {
+	options := js.options
+
+	source, err := transpile(options.Name, options.Script)
 	if err != nil {
-		fmt.Printf("%v\n", err)
-		os.Exit(1)
+		return nil, err
 	}
 
-	_, err = js.vm.RunProgram(program)
+	// parse separately from compiling, parser errors carry the position
+	var program *ast.Program
+
+	ext := filepath.Ext(options.Name)
+	module := ext == ".mjs" || ext == ".mts"
+
+	if !module {
+		program, err = parser.ParseFile(nil, options.Name, source, 0)
+
+		if err != nil {
+			// import and export are only valid in modules
+			moduleProgram, moduleErr := parser.ParseFile(nil, options.Name, source, 0, parser.IsModule)
+			if moduleErr != nil {
+				return nil, newCompileError(options.Name, err)
+			}
+
+			program, module = moduleProgram, true
+		}
+	} else {
+		program, err = parser.ParseFile(nil, options.Name, source, 0, parser.IsModule)
+
+		if err != nil {
+			return nil, newCompileError(options.Name, err)
+		}
+	}
+
+	var exports *sobek.Object
+
+	err = js.interruptAfter(options.Timeout, func() error {
+		if module {
+			exports, err = js.modules.evaluateMain(options.Name, program)
+			return err
+		}
+
+		compiled, err := sobek.CompileAST(program, false)
+		if err != nil {
+			return newCompileError(options.Name, err)
+		}
+
+		js.program = compiled
+
+		_, err = js.vm.RunProgram(compiled)
+		return err
+	})
 
 	if err != nil {
-		fmt.Printf("%v\n", err)
-		os.Exit(1)
+		return nil, wrapRuntimeError(err, options.Timeout)
+	}
+
+	return exports, nil
+}
+
+// resolve sets the handle function, or the handlers map checked against the
+// monitored tables, and the handleBatch function. A script defining only
+// handleBatch handles single events with it as well.
+func (js *JavaScript) resolve(exports *sobek.Object) error {
+	if handleBatch, ok := sobek.AssertFunction(js.lookup(exports, batchHandlerName)); ok {
+		js.handleBatch = handleBatch
 	}
 
-	var handle func() (interface{}, error)
-	handleFunction := js.vm.Get("handle")
+	handlers := js.lookup(exports, handlersName)
+
+	if handlers == nil || sobek.IsUndefined(handlers) {
+		handle, ok := sobek.AssertFunction(js.lookup(exports, handlerName))
+		if !ok && js.handleBatch != nil {
+			return nil
+		}
+		if !ok {
+			return &MissingHandlerError{Name: handlerName}
+		}
+
+		js.handle = handle
+		return nil
+	}
 
-	if handleFunction == nil {
-		fmt.Println("handle is not defined")
-		os.Exit(1)
+	if handle := js.lookup(exports, handlerName); handle != nil && !sobek.IsUndefined(handle) {
+		return fmt.Errorf("define either %s or %s, not both", handlerName, handlersName)
 	}
 
-	err = js.vm.ExportTo(handleFunction, &handle)
+	dispatch, err := newDispatch(handlers)
 	if err != nil {
 		return err
 	}
 
-	output, err := handle()
+	if err := dispatch.check(js.options.Tables); err != nil {
+		return err
+	}
+
+	js.handlers = dispatch
+
+	return nil
+}
+
+// lookup returns an export of the module, falling back to a global.
+func (js *JavaScript) lookup(exports *sobek.Object, name string) sobek.Value {
+	if exports != nil {
+		if value := exports.Get(name); value != nil && !sobek.IsUndefined(value) {
+			return value
+		}
+	}
+
+	return js.vm.Get(name)
+}
+
+// Files returns the handler file and every module it loaded so far.
+func (js *JavaScript) Files() []string {
+	return append([]string(nil), js.modules.files...)
+}
+
+// Execute runs the handle function, or the handler of the event's table and
+// operation, for a single event and returns what the handler decided through
+// dbscript.ctx. Uncaught exceptions and rejected promises are returned as an
+// *ExceptionError, unhandled rejections as an *UnhandledRejectionError and
+// interrupts as a *TimeoutError, the pipeline treats them like a call to
+// dbscript.ctx.error.
+func (js *JavaScript) Execute(e event.Event) (event.Outcome, error) {
+	if js.handle == nil && js.handlers == nil {
+		outcomes, err := js.ExecuteBatch([]event.Event{e})
+		if err != nil {
+			return event.Outcome{}, err
+		}
+		return outcomes[0], nil
+	}
+
+	handle := js.handle
+
+	if js.handlers != nil {
+		var err error
+		if handle, err = js.handlers.find(e); err != nil {
+			return event.Outcome{}, err
+		}
+	}
+
+	ctx := &js.runtime.Context
+	ctx.reset(e)
+
+	js.log.reset(e)
+	defer js.log.flush()
+
+	timeout := js.timeout(e)
+
+	js.runtime.State.begin(sourceOf(e))
+
+	if err := js.call(handle, ctx.current, timeout); err != nil {
+		js.runtime.State.end(false)
+		return event.Outcome{}, wrapRuntimeError(err, timeout)
+	}
+
+	outcome, err := ctx.result()
+
+	// errored events are retried, their writes must not be applied twice
+	js.runtime.State.end(err == nil && outcome.Action != event.Error)
+
+	return outcome, err
+}
+
+// ExecuteBatch runs the handleBatch function with events of a single source
+// and returns the outcome of each event in order, scripts without
+// handleBatch handle them one at a time. Failures of the whole invocation
+// are returned like in Execute. The budget of the invocation is the longest
+// timeout of the events' tables.
+func (js *JavaScript) ExecuteBatch(events []event.Event) ([]event.Outcome, error) {
+	if js.handleBatch == nil {
+		outcomes := make([]event.Outcome, len(events))
+
+		for i, e := range events {
+			outcome, err := js.Execute(e)
+			if err != nil {
+				outcome = event.Outcome{Action: event.Error, Event: e, Err: err}
+			}
+			outcomes[i] = outcome
+		}
+
+		return outcomes, nil
+	}
+
+	if len(events) == 0 {
+		return nil, nil
+	}
+
+	ctx := &js.runtime.Context
+	envelopes := ctx.resetBatch(events)
+
+	js.log.resetBatch(events)
+	defer js.log.flush()
+
+	var timeout time.Duration
+	for _, e := range events {
+		timeout = max(timeout, js.timeout(e))
+	}
+
+	js.runtime.State.begin(sourceOf(events[0]))
+
+	if err := js.call(js.handleBatch, envelopes, timeout); err != nil {
+		js.runtime.State.end(false)
+		return nil, wrapRuntimeError(err, timeout)
+	}
+
+	outcomes, err := ctx.results()
+
+	// errored events are retried on their own and would apply the writes of
+	// the batch again, a batch writing state is retried as a whole instead
+	if err == nil && js.runtime.State.written() {
+		if i := slices.IndexFunc(outcomes, func(o event.Outcome) bool { return o.Action == event.Error }); i >= 0 {
+			err = fmt.Errorf("batch wrote state and event %d errored: %w", i, outcomes[i].Err)
+		}
+	}
+
+	js.runtime.State.end(err == nil)
+
 	if err != nil {
-		switch e := err.(type) {
-		case *sobek.InterruptedError:
-			fmt.Printf("%v\n", e)
-			os.Exit(1)
-
-		case *sobek.Exception:
-			fmt.Printf("%v\n", e)
-			os.Exit(1)
+		return nil, err
+	}
+
+	return outcomes, nil
+}
+
+// call invokes fn with arg and waits for the promise it may return.
+func (js *JavaScript) call(fn sobek.Callable, arg any, timeout time.Duration) error {
+	return js.interruptAfter(timeout, func() error {
+		defer js.loop.reset()
+
+		result, err := fn(sobek.Undefined(), js.vm.ToValue(arg))
+		if err != nil {
+			return err
 		}
+
+		// async handlers decide once their promise settles
+		return js.loop.wait(result, js.deadline, timeout)
+	})
+}
+
+// Shutdown calls the optional shutdown function, it must only be called once
+// no more events are executed. State written by shutdown is committed
+// unless it fails.
+func (js *JavaScript) Shutdown() error {
+	if js.shutdown == nil {
+		return nil
 	}
-	fmt.Printf("output: %v\n", output)
+
+	js.runtime.Context.clear()
+
+	js.log.resetHook()
+	defer js.log.flush()
+
+	js.runtime.State.begin("")
+
+	err := js.call(js.shutdown, sobek.Undefined(), js.options.Timeout)
+
+	js.runtime.State.end(err == nil)
+
+	if err != nil {
+		return wrapRuntimeError(err, js.options.Timeout)
+	}
+
 	return nil
 }
+
+// timeout returns the execution budget for the event's table.
+func (js *JavaScript) timeout(e event.Event) time.Duration {
+	if timeout, ok := js.options.TableTimeouts[event.TableOf(e)]; ok {
+		return timeout
+	}
+
+	return js.options.Timeout
+}
+
+// interruptAfter runs fn interrupting the VM with a *TimeoutError once
+// timeout elapses. The interrupt is always cleared before returning so it
+// never leaks into the next invocation.
+func (js *JavaScript) interruptAfter(timeout time.Duration, fn func() error) error {
+	if timeout <= 0 {
+		return fn()
+	}
+
+	js.deadline = time.Now().Add(timeout)
+	defer func() { js.deadline = time.Time{} }()
+
+	fired := make(chan struct{})
+	timer := time.AfterFunc(timeout, func() {
+		js.vm.Interrupt(&TimeoutError{Timeout: timeout})
+		close(fired)
+	})
+
+	err := fn()
+
+	if !timer.Stop() {
+		// the interrupt may have been raised after fn returned, wait for it
+		// before clearing
+		<-fired
+		js.vm.ClearInterrupt()
+	}
+
+	return err
+}
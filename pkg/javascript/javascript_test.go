@@ -0,0 +1,315 @@
+package javascript
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/JayJamieson/dbscript/pkg/event"
+	"github.com/JayJamieson/dbscript/pkg/mysql"
+)
+
+func createTestEvent() event.Event {
+	return event.New(mysql.RowChangeEvent{
+		Source:            "default",
+		Database:          "dbscript",
+		Table:             "user",
+		Type:              "UPDATE",
+		TimeStamp:         1234567890,
+		Position:          "1000",
+		ServerID:          "1",
+		PrimaryKey:        []any{1},
+		PrimaryKeyColumns: []string{"id"},
+		Before: map[string]any{
+			"id":    1,
+			"email": "john@example.com",
+		},
+		After: map[string]any{
+			"id":    1,
+			"email": "john.doe@example.com",
+		},
+	})
+}
+
+func TestExecuteReusesVM(t *testing.T) {
+	js, err := New(Options{Script: `
+		var calls = 0;
+		var lastEmail;
+
+		function handle(event) {
+			calls++;
+			lastEmail = event.payload.after.email;
+		}
+	`})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := js.Execute(createTestEvent()); err != nil {
+			t.Fatalf("Execute() error = %v", err)
+		}
+	}
+
+	if calls := js.vm.Get("calls").ToInteger(); calls != 3 {
+		t.Errorf("calls = %d, expected 3", calls)
+	}
+
+	if email := js.vm.Get("lastEmail").String(); email != "john.doe@example.com" {
+		t.Errorf("lastEmail = %q, expected %q", email, "john.doe@example.com")
+	}
+}
+
+func BenchmarkExecute(b *testing.B) {
+	js, err := New(Options{Script: `
+		function handle(event) {
+			var row = event.payload;
+			if (row.type === "UPDATE" && row.before.email !== row.after.email) {
+				event.metadata.changed = "email";
+			}
+			dbscript.ctx.ok(event);
+		}
+	`})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	e := createTestEvent()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := js.Execute(e); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestExecuteBatch(t *testing.T) {
+	js, err := New(Options{Name: "handler.js", Script: `
+		var sizes = [];
+
+		function handleBatch(events) {
+			sizes.push(events.length);
+
+			events.forEach(function (event) {
+				switch (event.payload.table) {
+				case "orders":
+					dbscript.ctx.drop("orders", event);
+					break;
+				case "accounts":
+					dbscript.ctx.error("accounts", event);
+					break;
+				case "user":
+					dbscript.ctx.emit({ payload: "derived" }, { parent: event });
+					break;
+				}
+			});
+		}
+	`})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	events := []event.Event{
+		createTableEvent("user", "INSERT"),
+		createTableEvent("orders", "INSERT"),
+		createTableEvent("accounts", "INSERT"),
+	}
+
+	outcomes, err := js.ExecuteBatch(events)
+	if err != nil {
+		t.Fatalf("ExecuteBatch() error = %v", err)
+	}
+
+	expected := []event.Action{event.Ok, event.Drop, event.Error}
+
+	if len(outcomes) != len(expected) {
+		t.Fatalf("len(outcomes) = %d, expected %d", len(outcomes), len(expected))
+	}
+
+	for i, outcome := range outcomes {
+		if outcome.Action != expected[i] {
+			t.Errorf("outcomes[%d].Action = %v, expected %v", i, outcome.Action, expected[i])
+		}
+	}
+
+	if len(outcomes[0].Emitted) != 1 {
+		t.Fatalf("len(outcomes[0].Emitted) = %d, expected 1", len(outcomes[0].Emitted))
+	}
+
+	if parent := outcomes[0].Emitted[0].Metadata[event.MetadataParentID]; parent != events[0].Metadata[event.MetadataID] {
+		t.Errorf("parentId = %v, expected %v", parent, events[0].Metadata[event.MetadataID])
+	}
+
+	// single events run handleBatch with a batch of one
+	outcome, err := js.Execute(createTableEvent("orders", "UPDATE"))
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	if outcome.Action != event.Drop {
+		t.Errorf("Action = %v, expected %v", outcome.Action, event.Drop)
+	}
+
+	if sizes := js.vm.Get("sizes").Export(); !reflect.DeepEqual(sizes, []any{int64(3), int64(1)}) {
+		t.Errorf("sizes = %v, expected [3 1]", sizes)
+	}
+}
+
+func TestExecuteBatchErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		script   string
+		expected string
+	}{
+		{
+			name:     "event is required",
+			script:   `function handleBatch(events) { dbscript.ctx.drop("all"); }`,
+			expected: "handleBatch must pass the event",
+		},
+		{
+			name:     "event not in the batch",
+			script:   `function handleBatch(events) { dbscript.ctx.ok({ metadata: { id: "other" }, payload: {} }); }`,
+			expected: `event other is not part of the batch`,
+		},
+		{
+			name:     "emit without parent",
+			script:   `function handleBatch(events) { dbscript.ctx.emit({ payload: 1 }); }`,
+			expected: "handleBatch must pass the event",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			js, err := New(Options{Name: "handler.js", Script: tt.script})
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			_, err = js.ExecuteBatch([]event.Event{createTestEvent()})
+			if err == nil || !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("error = %v, expected it to contain %q", err, tt.expected)
+			}
+		})
+	}
+}
+
+func TestExecuteBatchWithoutHandleBatch(t *testing.T) {
+	js, err := New(Options{Script: `
+		function handle(event) {
+			if (event.payload.table === "orders") {
+				throw new Error("boom");
+			}
+		}
+	`})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	outcomes, err := js.ExecuteBatch([]event.Event{createTableEvent("user", "INSERT"), createTableEvent("orders", "INSERT")})
+	if err != nil {
+		t.Fatalf("ExecuteBatch() error = %v", err)
+	}
+
+	if outcomes[0].Action != event.Ok || outcomes[1].Action != event.Error {
+		t.Errorf("actions = %v %v, expected ok error", outcomes[0].Action, outcomes[1].Action)
+	}
+}
+
+func TestLifecycleHooks(t *testing.T) {
+	js, err := New(Options{
+		Name:   "handler.js",
+		Config: map[string]any{"threshold": 10, "regions": []string{"eu", "us"}},
+		Script: `
+			var threshold, modified, shutdownCalls = 0, shutdownEvent;
+
+			function init(config) {
+				threshold = config.threshold;
+
+				try {
+					(function () {
+						"use strict";
+						dbscript.config.regions.push("ap");
+					})();
+				} catch (e) {
+					modified = e instanceof TypeError ? "rejected" : String(e);
+				}
+			}
+
+			function handle(event) {
+				event.metadata.threshold = dbscript.config.threshold;
+			}
+
+			function shutdown() {
+				shutdownCalls++;
+				try {
+					dbscript.ctx.ok();
+				} catch (e) {
+					shutdownEvent = "none";
+				}
+			}
+		`,
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	if threshold := js.vm.Get("threshold").ToInteger(); threshold != 10 {
+		t.Errorf("threshold = %d, expected 10", threshold)
+	}
+
+	if modified := js.vm.Get("modified").String(); modified != "rejected" {
+		t.Errorf("modifying dbscript.config = %s, expected it to be rejected", modified)
+	}
+
+	outcome, err := js.Execute(createTestEvent())
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	if threshold := outcome.Event.Metadata["threshold"]; threshold != int64(10) {
+		t.Errorf("metadata.threshold = %v, expected 10", threshold)
+	}
+
+	if err := js.Shutdown(); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+
+	if calls := js.vm.Get("shutdownCalls").ToInteger(); calls != 1 {
+		t.Errorf("shutdownCalls = %d, expected 1", calls)
+	}
+
+	if shutdownEvent := js.vm.Get("shutdownEvent").String(); shutdownEvent != "none" {
+		t.Errorf("dbscript.ctx.ok() in shutdown should throw")
+	}
+}
+
+func TestShutdownErrors(t *testing.T) {
+	js, err := New(Options{Script: `
+		function handle(event) {}
+		function shutdown() { throw new Error("flush failed"); }
+	`})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	err = js.Shutdown()
+
+	var exceptionErr *ExceptionError
+	if !errors.As(err, &exceptionErr) {
+		t.Fatalf("error = %T %v, expected *ExceptionError", err, err)
+	}
+
+	// scripts without shutdown have nothing to do
+	js, err = New(Options{Script: `function handle(event) {}`})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	if err := js.Shutdown(); err != nil {
+		t.Errorf("Shutdown() error = %v", err)
+	}
+}
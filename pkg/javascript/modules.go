@@ -0,0 +1,409 @@
+package javascript
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/grafana/sobek"
+	"github.com/grafana/sobek/ast"
+)
+
+// builtinPrefix marks specifiers of modules implemented in Go.
+const builtinPrefix = "dbscript:"
+
+// builtinGlobal is the hidden global generated ES modules use to reach the
+// Go implementation of a built-in module.
+const builtinGlobal = "__dbscript_builtin"
+
+var identifier = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*$`)
+
+// ModuleNotFoundError is returned when a required or imported module does
+// not exist.
+type ModuleNotFoundError struct {
+	Specifier string
+	From      string
+}
+
+func (e *ModuleNotFoundError) Error() string {
+	return fmt.Sprintf("cannot find module %q from %s", e.Specifier, e.From)
+}
+
+// ModuleCycleError is returned when modules depend on each other.
+type ModuleCycleError struct {
+	Cycle []string
+}
+
+func (e *ModuleCycleError) Error() string {
+	return "circular module dependency: " + strings.Join(e.Cycle, " -> ")
+}
+
+// modules resolves require() calls and import statements relative to the
+// module doing the import. Every module is loaded once per VM.
+type modules struct {
+	js      *JavaScript
+	vm      *sobek.Runtime
+	baseDir string
+
+	// files lists every file loaded so far in load order
+	files []string
+
+	builtins map[string]*sobek.Object
+
+	// CommonJS modules by path, loading is the stack of modules currently
+	// being required
+	cjs     map[string]*sobek.Object
+	loading []string
+
+	// ES modules by path, edges records imports for cycle detection
+	esm   map[string]sobek.ModuleRecord
+	paths map[sobek.ModuleRecord]string
+	edges map[string][]string
+}
+
+func newModules(js *JavaScript, name string) *modules {
+	baseDir := "."
+	if name != "" {
+		baseDir = filepath.Dir(name)
+	}
+
+	m := &modules{
+		js:       js,
+		vm:       js.vm,
+		baseDir:  baseDir,
+		builtins: make(map[string]*sobek.Object),
+		cjs:      make(map[string]*sobek.Object),
+		esm:      make(map[string]sobek.ModuleRecord),
+		paths:    make(map[sobek.ModuleRecord]string),
+		edges:    make(map[string][]string),
+	}
+
+	if name != "" {
+		m.files = append(m.files, name)
+	}
+
+	return m
+}
+
+// install defines the global require, resolving relative to the handler,
+// and the hidden built-in accessor.
+func (m *modules) install() error {
+	if err := m.vm.Set("require", m.require(m.baseDir)); err != nil {
+		return err
+	}
+
+	return m.vm.GlobalObject().DefineDataProperty(builtinGlobal, m.vm.ToValue(m.builtin), sobek.FLAG_FALSE, sobek.FLAG_FALSE, sobek.FLAG_FALSE)
+}
+
+func (m *modules) track(path string) {
+	for _, file := range m.files {
+		if file == path {
+			return
+		}
+	}
+
+	m.files = append(m.files, path)
+}
+
+func (m *modules) builtin(name string) (*sobek.Object, error) {
+	if exports, ok := m.builtins[name]; ok {
+		return exports, nil
+	}
+
+	newModule, ok := builtinModules[strings.TrimPrefix(name, builtinPrefix)]
+	if !ok {
+		return nil, &ModuleNotFoundError{Specifier: name, From: "built-in modules"}
+	}
+
+	exports, err := newModule(m.js)
+	if err != nil {
+		return nil, err
+	}
+
+	m.builtins[name] = exports
+
+	return exports, nil
+}
+
+// resolveExtensions are tried in order for specifiers without an extension.
+var resolveExtensions = []string{".js", ".ts"}
+
+// resolve returns the path of a relative or absolute specifier, adding a .js
+// or .ts extension when the file has none.
+func (m *modules) resolve(dir, specifier, from string) (string, error) {
+	if !strings.HasPrefix(specifier, "./") && !strings.HasPrefix(specifier, "../") && !filepath.IsAbs(specifier) {
+		return "", &ModuleNotFoundError{Specifier: specifier, From: from}
+	}
+
+	path := specifier
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, specifier)
+	}
+
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+
+	if filepath.Ext(path) == "" {
+		for _, ext := range resolveExtensions {
+			if _, err := os.Stat(path + ext); err == nil {
+				return path + ext, nil
+			}
+		}
+	}
+
+	return "", &ModuleNotFoundError{Specifier: specifier, From: from}
+}
+
+// require returns the require function for a module in dir.
+func (m *modules) require(dir string) func(specifier string) (sobek.Value, error) {
+	return func(specifier string) (sobek.Value, error) {
+		if strings.HasPrefix(specifier, builtinPrefix) {
+			return m.builtin(specifier)
+		}
+
+		from := filepath.Join(dir, "<require>")
+		if len(m.loading) > 0 {
+			from = m.loading[len(m.loading)-1]
+		}
+
+		path, err := m.resolve(dir, specifier, from)
+		if err != nil {
+			return nil, err
+		}
+
+		for i, loading := range m.loading {
+			if loading == path {
+				cycle := append(append([]string{}, m.loading[i:]...), path)
+				return nil, &ModuleCycleError{Cycle: cycle}
+			}
+		}
+
+		if module, ok := m.cjs[path]; ok {
+			return module.Get("exports"), nil
+		}
+
+		return m.loadCommonJS(path)
+	}
+}
+
+// read returns the transpiled source of a module.
+func (m *modules) read(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	m.track(path)
+
+	return transpile(path, string(data))
+}
+
+func (m *modules) loadCommonJS(path string) (sobek.Value, error) {
+	source, err := m.read(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// keep the wrapper on the first line so line numbers match the file
+	wrapped := "(function (exports, require, module, __filename, __dirname) {" + source + "\n})"
+
+	program, err := sobek.Compile(path, wrapped, false)
+	if err != nil {
+		return nil, newCompileError(path, err)
+	}
+
+	fn, err := m.vm.RunProgram(program)
+	if err != nil {
+		return nil, err
+	}
+
+	call, ok := sobek.AssertFunction(fn)
+	if !ok {
+		return nil, fmt.Errorf("loading %s: module wrapper is not a function", path)
+	}
+
+	module := m.vm.NewObject()
+	exports := m.vm.NewObject()
+	if err := module.Set("exports", exports); err != nil {
+		return nil, err
+	}
+
+	m.cjs[path] = module
+	m.loading = append(m.loading, path)
+
+	_, err = call(sobek.Undefined(),
+		exports,
+		m.vm.ToValue(m.require(filepath.Dir(path))),
+		module,
+		m.vm.ToValue(path),
+		m.vm.ToValue(filepath.Dir(path)),
+	)
+
+	m.loading = m.loading[:len(m.loading)-1]
+
+	if err != nil {
+		// a failed module is loaded again on the next require
+		delete(m.cjs, path)
+		return nil, err
+	}
+
+	return module.Get("exports"), nil
+}
+
+// resolveModule implements sobek.HostResolveImportedModuleFunc for import
+// statements.
+func (m *modules) resolveModule(referencing any, specifier string) (sobek.ModuleRecord, error) {
+	from := filepath.Join(m.baseDir, "<handler>")
+	dir := m.baseDir
+
+	if record, ok := referencing.(sobek.ModuleRecord); ok {
+		if path, ok := m.paths[record]; ok {
+			from = path
+			dir = filepath.Dir(path)
+		}
+	}
+
+	var path, source string
+
+	if strings.HasPrefix(specifier, builtinPrefix) {
+		path = specifier
+
+		if _, ok := m.esm[path]; !ok {
+			generated, err := m.builtinSource(specifier)
+			if err != nil {
+				return nil, err
+			}
+			source = generated
+		}
+	} else {
+		resolved, err := m.resolve(dir, specifier, from)
+		if err != nil {
+			return nil, err
+		}
+		path = resolved
+	}
+
+	m.edges[from] = append(m.edges[from], path)
+
+	if record, ok := m.esm[path]; ok {
+		return record, nil
+	}
+
+	if source == "" {
+		data, err := m.read(path)
+		if err != nil {
+			return nil, err
+		}
+		source = data
+	}
+
+	record, err := sobek.ParseModule(path, source, m.resolveModule)
+	if err != nil {
+		return nil, newCompileError(path, err)
+	}
+
+	m.esm[path] = record
+	m.paths[record] = path
+
+	return record, nil
+}
+
+// builtinSource generates an ES module re-exporting a built-in module.
+func (m *modules) builtinSource(name string) (string, error) {
+	exports, err := m.builtin(name)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "const m = globalThis.%s(%q);\nexport default m;\n", builtinGlobal, name)
+
+	for _, key := range exports.Keys() {
+		if identifier.MatchString(key) && key != "default" {
+			fmt.Fprintf(&b, "export const %s = m.%s;\n", key, key)
+		}
+	}
+
+	return b.String(), nil
+}
+
+// evaluateMain links and evaluates the handler as an ES module and returns
+// its exports.
+func (m *modules) evaluateMain(name string, program *ast.Program) (*sobek.Object, error) {
+	record, err := sobek.ModuleFromAST(program, m.resolveModule)
+	if err != nil {
+		return nil, newCompileError(name, err)
+	}
+
+	from := filepath.Join(m.baseDir, "<handler>")
+	if name != "" {
+		from = name
+	}
+	m.esm[from] = record
+	m.paths[record] = from
+
+	if err := record.Link(); err != nil {
+		return nil, err
+	}
+
+	if cycle := m.findCycle(from); cycle != nil {
+		return nil, &ModuleCycleError{Cycle: cycle}
+	}
+
+	promise := m.vm.CyclicModuleRecordEvaluate(record, m.resolveModule)
+
+	if promise.State() == sobek.PromiseStateRejected {
+		return nil, promiseError(promise.Result())
+	}
+
+	return m.vm.NamespaceObjectFor(record), nil
+}
+
+// findCycle returns the first import cycle reachable from start.
+func (m *modules) findCycle(start string) []string {
+	var stack []string
+	done := make(map[string]bool)
+
+	var visit func(path string) []string
+	visit = func(path string) []string {
+		for i, p := range stack {
+			if p == path {
+				return append(append([]string{}, stack[i:]...), path)
+			}
+		}
+
+		if done[path] {
+			return nil
+		}
+
+		stack = append(stack, path)
+		for _, next := range m.edges[path] {
+			if cycle := visit(next); cycle != nil {
+				return cycle
+			}
+		}
+		stack = stack[:len(stack)-1]
+		done[path] = true
+
+		return nil
+	}
+
+	return visit(start)
+}
+
+// promiseError converts the rejection value of a module evaluation.
+func promiseError(reason sobek.Value) error {
+	if reason == nil {
+		return errors.New("module evaluation failed")
+	}
+
+	if err, ok := reason.Export().(error); ok {
+		return err
+	}
+
+	return &ExceptionError{Message: reason.String()}
+}
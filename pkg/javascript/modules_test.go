@@ -0,0 +1,230 @@
+package javascript
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeModules writes files relative to a temporary directory and returns it.
+func writeModules(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, source := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(source), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+func loadHandler(t *testing.T, dir string, name string) (*JavaScript, error) {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	script, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return New(Options{Name: path, Script: string(script)})
+}
+
+func TestModules(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler string
+		files   map[string]string
+		email   string
+	}{
+		{
+			name:    "require relative to the handler",
+			handler: "handler.js",
+			files: map[string]string{
+				"handler.js": `
+					var mask = require('./lib/mask.js');
+					function handle(event) { event.payload.after.email = mask.email(event.payload.after.email); }
+				`,
+				"lib/mask.js": `
+					var util = require('./util');
+					exports.email = function (value) { return util.prefix + value; };
+				`,
+				"lib/util.js": `module.exports = { prefix: "masked:" };`,
+			},
+			email: "masked:john.doe@example.com",
+		},
+		{
+			name:    "require built-in module",
+			handler: "handler.js",
+			files: map[string]string{
+				"handler.js": `
+					var mask = require('dbscript:mask');
+					function handle(event) { event.payload.after.email = mask.email(event.payload.after.email); }
+				`,
+			},
+			email: "j*******@example.com",
+		},
+		{
+			name:    "import relative to the handler",
+			handler: "handler.js",
+			files: map[string]string{
+				"handler.js": `
+					import { email } from './lib/mask.js';
+					export function handle(event) { event.payload.after.email = email(event.payload.after.email); }
+				`,
+				"lib/mask.js": `
+					import { prefix } from './util.js';
+					export function email(value) { return prefix + value; }
+				`,
+				"lib/util.js": `export const prefix = "masked:";`,
+			},
+			email: "masked:john.doe@example.com",
+		},
+		{
+			name:    "import built-in module",
+			handler: "handler.mjs",
+			files: map[string]string{
+				"handler.mjs": `
+					import mask, { redact } from 'dbscript:mask';
+					export function handle(event) { event.payload.after.email = redact(mask.email(event.payload.after.email), 4); }
+				`,
+			},
+			email: "****************.com",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			js, err := loadHandler(t, writeModules(t, tt.files), tt.handler)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			outcome, err := js.Execute(createTestEvent())
+			if err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+
+			after := outcome.Event.Payload.(map[string]any)["after"].(map[string]any)
+			if after["email"] != tt.email {
+				t.Errorf("email = %v, expected %v", after["email"], tt.email)
+			}
+
+			if files := js.Files(); len(files) != len(tt.files) {
+				t.Errorf("Files() = %v, expected %d files", files, len(tt.files))
+			}
+		})
+	}
+}
+
+func TestRequireCache(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"handler.js": `
+			var a = require('./counter.js');
+			var b = require('./lib/../counter.js');
+			function handle(event) { event.metadata.loads = a.loads + b.loads; }
+		`,
+		"counter.js": `
+			globalThis.loads = (globalThis.loads || 0) + 1;
+			exports.loads = globalThis.loads;
+		`,
+	})
+
+	js, err := loadHandler(t, dir, "handler.js")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	if loads := js.vm.Get("loads").ToInteger(); loads != 1 {
+		t.Errorf("loads = %d, expected 1", loads)
+	}
+}
+
+func TestModuleErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler string
+		files   map[string]string
+		message string
+	}{
+		{
+			name:    "require cycle",
+			handler: "handler.js",
+			files: map[string]string{
+				"handler.js": `require('./a.js'); function handle() {}`,
+				"a.js":       `require('./b.js');`,
+				"b.js":       `require('./a.js');`,
+			},
+			message: "a.js -> ",
+		},
+		{
+			name:    "import cycle",
+			handler: "handler.mjs",
+			files: map[string]string{
+				"handler.mjs": `import './a.js'; export function handle() {}`,
+				"a.js":        `import './b.js';`,
+				"b.js":        `import './a.js';`,
+			},
+			message: "circular module dependency",
+		},
+		{
+			name:    "missing module",
+			handler: "handler.js",
+			files: map[string]string{
+				"handler.js": `require('./missing.js'); function handle() {}`,
+			},
+			message: `cannot find module "./missing.js"`,
+		},
+		{
+			name:    "missing import",
+			handler: "handler.mjs",
+			files: map[string]string{
+				"handler.mjs": `import './missing.js'; export function handle() {}`,
+			},
+			message: `cannot find module "./missing.js"`,
+		},
+		{
+			name:    "unknown built-in module",
+			handler: "handler.js",
+			files: map[string]string{
+				"handler.js": `require('dbscript:nope'); function handle() {}`,
+			},
+			message: `cannot find module "dbscript:nope"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadHandler(t, writeModules(t, tt.files), tt.handler)
+			if err == nil {
+				t.Fatal("New() expected an error")
+			}
+
+			if !strings.Contains(err.Error(), tt.message) {
+				t.Errorf("New() error = %v, expected it to contain %q", err, tt.message)
+			}
+		})
+	}
+}
+
+func TestImportCycleError(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"handler.mjs": `import './a.js'; export function handle() {}`,
+		"a.js":        `import './handler.mjs';`,
+	})
+
+	_, err := loadHandler(t, dir, "handler.mjs")
+
+	var cycleErr *ModuleCycleError
+	if !errors.As(err, &cycleErr) {
+		t.Fatalf("New() error = %T %v, expected *ModuleCycleError", err, err)
+	}
+}
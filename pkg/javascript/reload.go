@@ -0,0 +1,189 @@
+package javascript
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/JayJamieson/dbscript/pkg/event"
+)
+
+// DefaultWatchInterval is how often Watch checks the script for changes.
+const DefaultWatchInterval = time.Second
+
+// Reloader is a handler whose script is reloaded from disk while running.
+// A new version is only swapped in when it compiles and its init hook
+// succeeds, otherwise the current version keeps running. The swap happens
+// between events, an invocation always runs on a single version, and the
+// replaced version is shut down once no invocation runs on it.
+type Reloader struct {
+	options Options
+	logger  *slog.Logger
+	current atomic.Pointer[JavaScript]
+
+	// running is held for reading by invocations and for writing by the swap
+	running sync.RWMutex
+
+	// mu serialises reloads and guards modTimes
+	mu       sync.Mutex
+	modTimes map[string]time.Time
+}
+
+// NewReloader loads the script at options.Name.
+func NewReloader(options Options, logger *slog.Logger) (*Reloader, error) {
+	r := &Reloader{
+		options: options,
+		logger:  logger,
+	}
+
+	js, modTimes, err := r.load()
+	if err != nil {
+		return nil, err
+	}
+
+	r.current.Store(js)
+	r.modTimes = modTimes
+
+	return r, nil
+}
+
+// Execute runs the current version of the script.
+func (r *Reloader) Execute(e event.Event) (event.Outcome, error) {
+	r.running.RLock()
+	defer r.running.RUnlock()
+
+	return r.current.Load().Execute(e)
+}
+
+// ExecuteBatch runs the current version of the script with a batch.
+func (r *Reloader) ExecuteBatch(events []event.Event) ([]event.Outcome, error) {
+	r.running.RLock()
+	defer r.running.RUnlock()
+
+	return r.current.Load().ExecuteBatch(events)
+}
+
+// Shutdown calls the shutdown function of the current version.
+func (r *Reloader) Shutdown() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.current.Load().Shutdown()
+}
+
+// Reload loads the script from disk and swaps it in if it is valid.
+func (r *Reloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.reload()
+}
+
+func (r *Reloader) reload() error {
+	js, modTimes, err := r.load()
+
+	// remember the failed version so it is not retried until it changes again
+	if modTimes != nil {
+		r.modTimes = modTimes
+	}
+
+	if err != nil {
+		r.logger.Error("Error reloading handler, keeping current version", "handler", r.options.Name, "error", err)
+		return err
+	}
+
+	r.running.Lock()
+	old := r.current.Swap(js)
+	r.running.Unlock()
+
+	r.logger.Info("Reloaded handler", "handler", r.options.Name)
+
+	// invocations started after the swap run on the new version
+	if err := old.Shutdown(); err != nil {
+		r.logger.Error("Error shutting down replaced handler", "handler", r.options.Name, "error", err)
+	}
+
+	return nil
+}
+
+func (r *Reloader) load() (*JavaScript, map[string]time.Time, error) {
+	info, err := os.Stat(r.options.Name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	script, err := os.ReadFile(r.options.Name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	options := r.options
+	options.Script = string(script)
+
+	js, err := New(options)
+
+	// watch the modules the new version loaded, or the ones watched so far
+	// when it failed part way
+	var files []string
+	if js != nil {
+		files = js.Files()
+	} else {
+		for path := range r.modTimes {
+			files = append(files, path)
+		}
+	}
+
+	modTimes := map[string]time.Time{r.options.Name: info.ModTime()}
+
+	for _, path := range files {
+		if _, ok := modTimes[path]; ok {
+			continue
+		}
+
+		if info, err := os.Stat(path); err == nil {
+			modTimes[path] = info.ModTime()
+		}
+	}
+
+	return js, modTimes, err
+}
+
+// Watch polls the script and the modules it imports for changes every interval and reloads it until ctx
+// is cancelled.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.mu.Lock()
+			if r.changed() {
+				_ = r.reload()
+			}
+			r.mu.Unlock()
+		}
+	}
+}
+
+func (r *Reloader) changed() bool {
+	for path, modTime := range r.modTimes {
+		info, err := os.Stat(path)
+
+		// a missing file is usually an editor replacing it, wait for it
+		if err != nil {
+			continue
+		}
+
+		if !info.ModTime().Equal(modTime) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,187 @@
+package javascript
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/JayJamieson/dbscript/pkg/state"
+)
+
+func writeScript(t *testing.T, path string, script string) {
+	t.Helper()
+
+	if err := os.WriteFile(path, []byte(script), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// make sure the modification time changes on coarse grained filesystems
+	modTime := time.Now().Add(time.Duration(len(script)) * time.Second)
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func versionOf(t *testing.T, r *Reloader) any {
+	t.Helper()
+
+	outcome, err := r.Execute(createTestEvent())
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	return outcome.Event.Metadata["version"]
+}
+
+func TestReloader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "handler.js")
+	writeScript(t, path, `function handle(event) { event.metadata.version = 1; }`)
+
+	r, err := NewReloader(Options{Name: path}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("NewReloader() error = %v", err)
+	}
+
+	if version := versionOf(t, r); version != int64(1) {
+		t.Fatalf("version = %v, expected 1", version)
+	}
+
+	tests := []struct {
+		name    string
+		script  string
+		wantErr bool
+		version int64
+	}{
+		{
+			name:    "syntax error keeps current version",
+			script:  `function handle(event) { event.metadata.version = ; }`,
+			wantErr: true,
+			version: 1,
+		},
+		{
+			name:    "failing init keeps current version",
+			script:  `function init() { throw new Error("lookup table unavailable"); } function handle(event) { event.metadata.version = 2; }`,
+			wantErr: true,
+			version: 1,
+		},
+		{
+			name:    "missing handler keeps current version",
+			script:  `function handler(event) { event.metadata.version = 2; }`,
+			wantErr: true,
+			version: 1,
+		},
+		{
+			name:    "valid version is swapped in",
+			script:  `var version; function init() { version = 3; } function handle(event) { event.metadata.version = version; }`,
+			version: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeScript(t, path, tt.script)
+
+			if err := r.Reload(); (err != nil) != tt.wantErr {
+				t.Fatalf("Reload() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if version := versionOf(t, r); version != tt.version {
+				t.Errorf("version = %v, expected %d", version, tt.version)
+			}
+		})
+	}
+}
+
+func TestReloaderWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "handler.js")
+	writeScript(t, path, `function handle(event) { event.metadata.version = 1; }`)
+
+	r, err := NewReloader(Options{Name: path}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("NewReloader() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go r.Watch(ctx, 5*time.Millisecond)
+
+	writeScript(t, path, `function handle(event) { event.metadata.version = 2; } // changed`)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if versionOf(t, r) == int64(2) {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	t.Errorf("handler was not reloaded after the file changed")
+}
+
+func TestReloaderWatchesModules(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "handler.js")
+	lib := filepath.Join(dir, "version.js")
+
+	writeScript(t, lib, `module.exports = 1;`)
+	writeScript(t, path, `var version = require('./version.js'); function handle(event) { event.metadata.version = version; }`)
+
+	r, err := NewReloader(Options{Name: path}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("NewReloader() error = %v", err)
+	}
+
+	if r.changed() {
+		t.Fatalf("changed() = true before any module changed")
+	}
+
+	writeScript(t, lib, `module.exports = 2; // changed`)
+
+	if !r.changed() {
+		t.Fatalf("changed() = false after a module changed")
+	}
+
+	if err := r.Reload(); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+
+	if version := versionOf(t, r); version != int64(2) {
+		t.Errorf("version = %v, expected 2", version)
+	}
+}
+
+func TestReloaderShutsDownReplaced(t *testing.T) {
+	store, err := state.Open(filepath.Join(t.TempDir(), "state.db"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer store.Close()
+
+	path := filepath.Join(t.TempDir(), "handler.js")
+	writeScript(t, path, `function handle(event) {} function shutdown() { dbscript.state.incr("shutdown:1"); }`)
+
+	r, err := NewReloader(Options{Name: path, State: store}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("NewReloader() error = %v", err)
+	}
+
+	writeScript(t, path, `function handle(event) { event.metadata.replaced = dbscript.state.get("shutdown:1"); }`)
+
+	if err := r.Reload(); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+
+	outcome, err := r.Execute(createTestEvent())
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	if replaced := outcome.Event.Metadata["replaced"]; replaced != int64(1) {
+		t.Errorf("replaced = %#v, expected 1", replaced)
+	}
+}
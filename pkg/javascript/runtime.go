@@ -1,29 +1,406 @@
 package javascript
 
-import "log/slog"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
 
-// TODO: figure out a better setup to only ever require injecting events into
-// the runtimeCtx without the need of recreating the context every time.
-// Something that would also allow retrieving the event from the runtimeCtx handle
-// for further processing in other handlers or sending to the configured "sink"
+	"github.com/JayJamieson/dbscript/pkg/event"
+	"github.com/google/uuid"
+	"github.com/grafana/sobek"
+)
 
-type runtimeCtx struct{}
+// runtimeCtx is created once per VM, Execute only swaps the current event
+// and collects the outcome of the invocation.
+type runtimeCtx struct {
+	// current is the event envelope returned by getEvent, handlers modify
+	// it in place. It is nil while running handleBatch.
+	current map[string]any
+
+	// decisions hold the outcome of each event of the invocation, batch
+	// indexes them by id while running handleBatch
+	decisions []*decision
+	batch     map[string]*decision
+
+	// sinks are the names events can be routed to
+	sinks map[string]bool
+}
+
+// decision is what an invocation decided for one of its events.
+type decision struct {
+	envelope map[string]any
+	outcome  *event.Outcome
+	emitted  []event.Event
+}
 
 type Runtime struct {
 	Context runtimeCtx `json:"ctx"`
+	Log     *Logger    `json:"log"`
+	State   *State     `json:"state"`
+	DB      *DB        `json:"db"`
+
+	// Config is the frozen handler configuration.
+	Config sobek.Value `json:"config"`
+
+	lag func(source string) any
+}
+
+// freezeScript deep freezes a value parsed from JSON.
+const freezeScript = `(function freeze(value) {
+	if (value !== null && typeof value === "object") {
+		Object.getOwnPropertyNames(value).forEach(function (key) {
+			freeze(value[key]);
+		});
+		Object.freeze(value);
+	}
+	return value;
+})`
+
+// frozenConfig converts the handler configuration to a plain object that is
+// frozen, so handlers cannot modify it.
+func frozenConfig(vm *sobek.Runtime, config map[string]any) (sobek.Value, error) {
+	if config == nil {
+		config = map[string]any{}
+	}
+
+	data, err := json.Marshal(config)
+	if err != nil {
+		return nil, fmt.Errorf("handler config must be JSON encodable: %w", err)
+	}
+
+	freezeFn, err := vm.RunString(freezeScript)
+	if err != nil {
+		return nil, err
+	}
+
+	freeze, _ := sobek.AssertFunction(freezeFn)
+	parse, _ := sobek.AssertFunction(vm.Get("JSON").ToObject(vm).Get("parse"))
+
+	parsed, err := parse(sobek.Undefined(), vm.ToValue(string(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	return freeze(sobek.Undefined(), parsed)
+}
+
+// Lag returns the replication lag of the named source, undefined when the
+// source is unknown.
+func (r *Runtime) Lag(source string) any {
+	if r.lag == nil {
+		return nil
+	}
+
+	return r.lag(source)
 }
 
-// TODO: properly type event when figured out
-func (f *runtimeCtx) Ok(event any) {
-	slog.Info("Ok called", event)
+// reset prepares the context for a new invocation.
+func (f *runtimeCtx) reset(e event.Event) {
+	f.current = envelope(e)
+	f.decisions = []*decision{{envelope: f.current}}
+	f.batch = nil
 }
 
-// TODO: properly type event when figured out
-func (f *runtimeCtx) Drop(reason string, event any) {
-	slog.Info("Drop called", reason, event)
+// resetBatch prepares the context for a handleBatch invocation and returns
+// the envelopes passed to it.
+func (f *runtimeCtx) resetBatch(events []event.Event) []any {
+	envelopes := make([]any, len(events))
+
+	f.current = nil
+	f.decisions = make([]*decision, len(events))
+	f.batch = make(map[string]*decision, len(events))
+
+	for i, e := range events {
+		envelopes[i] = envelope(e)
+		f.decisions[i] = &decision{envelope: envelopes[i].(map[string]any)}
+		f.batch[fmt.Sprint(e.Metadata[event.MetadataID])] = f.decisions[i]
+	}
+
+	return envelopes
 }
 
-// TODO: properly type event when figured out
-func (f *runtimeCtx) Error(event any) {
-	slog.Info("Error called", event)
+func envelope(e event.Event) map[string]any {
+	return map[string]any{
+		"metadata": e.Metadata,
+		"payload":  e.Payload,
+	}
+}
+
+// clear ends the invocation, calls to ok, drop, error and emit fail until
+// the next one.
+func (f *runtimeCtx) clear() {
+	f.current = nil
+	f.decisions = nil
+	f.batch = nil
+}
+
+// source returns the source of the events of the invocation, a batch only
+// holds events of one source.
+func (f *runtimeCtx) source() string {
+	if len(f.decisions) == 0 {
+		return ""
+	}
+
+	metadata, _ := f.decisions[0].envelope["metadata"].(map[string]any)
+	source, _ := metadata[event.MetadataSource].(string)
+
+	return source
+}
+
+// GetEvent returns the current event as {metadata, payload}.
+func (f *runtimeCtx) GetEvent() map[string]any {
+	return f.current
+}
+
+// Ok forwards the event, or the current event when none is given, to the
+// named sinks or the default sink.
+func (f *runtimeCtx) Ok(value sobek.Value, sinks sobek.Value) error {
+	var names []string
+
+	if sinks != nil && !sobek.IsUndefined(sinks) && !sobek.IsNull(sinks) {
+		var err error
+		if names, err = f.sinkNames(sinks.Export()); err != nil {
+			return err
+		}
+	}
+
+	d, err := f.decide(event.Outcome{Action: event.Ok}, value)
+	if err != nil {
+		return err
+	}
+
+	if d.outcome.Action == event.Ok && d.outcome.Event.Sinks == nil {
+		d.outcome.Event.Sinks = names
+	}
+
+	return nil
+}
+
+// sinkNames converts a sink name or an array of names, rejecting names that
+// are not configured.
+func (f *runtimeCtx) sinkNames(value any) ([]string, error) {
+	var names []string
+
+	switch exported := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		names = []string{exported}
+	case []any:
+		for _, name := range exported {
+			names = append(names, fmt.Sprint(name))
+		}
+	default:
+		return nil, fmt.Errorf("sink must be a name or an array of names")
+	}
+
+	for _, name := range names {
+		if !f.sinks[name] {
+			return nil, &UnknownSinkError{Name: name}
+		}
+	}
+
+	return names, nil
+}
+
+// Drop skips the event recording why.
+func (f *runtimeCtx) Drop(reason string, value sobek.Value) error {
+	_, err := f.decide(event.Outcome{Action: event.Drop, Reason: reason}, value)
+	return err
+}
+
+// Error schedules the event for a retry.
+func (f *runtimeCtx) Error(reason sobek.Value, value sobek.Value) error {
+	outcome := event.Outcome{Action: event.Error, Err: errors.New("error called without an error")}
+
+	if reason != nil && !sobek.IsUndefined(reason) && !sobek.IsNull(reason) {
+		outcome.Err = errors.New(reason.String())
+	}
+
+	_, err := f.decide(outcome, value)
+	return err
+}
+
+// Emit queues an additional event, options may set the sink and the key it
+// is delivered with and the parent event it is derived from, the current
+// event by default. Emitted events get a new id unless they set one, and
+// inherit the timestamp and source of their parent.
+func (f *runtimeCtx) Emit(value sobek.Value, options sobek.Value) error {
+	if value == nil {
+		return fmt.Errorf("emitted event must be an object with a payload")
+	}
+
+	exported, ok := value.Export().(map[string]any)
+	if !ok {
+		return fmt.Errorf("emitted event must be an object with a payload")
+	}
+
+	var opts map[string]any
+
+	if options != nil && !sobek.IsUndefined(options) && !sobek.IsNull(options) {
+		if opts, ok = options.Export().(map[string]any); !ok {
+			return fmt.Errorf("emit options must be an object")
+		}
+	}
+
+	d, err := f.decisionFor(opts["parent"])
+	if err != nil {
+		return err
+	}
+
+	parent, _ := d.envelope["metadata"].(map[string]any)
+
+	metadata := make(map[string]any, len(parent)+1)
+	if m, ok := exported["metadata"].(map[string]any); ok {
+		maps.Copy(metadata, m)
+	} else if exported["metadata"] != nil {
+		return fmt.Errorf("event metadata must be an object")
+	}
+
+	for _, key := range []string{event.MetadataTimestamp, event.MetadataSource} {
+		if _, ok := metadata[key]; !ok && parent[key] != nil {
+			metadata[key] = parent[key]
+		}
+	}
+
+	// events copied from the current one would share its id
+	if id, ok := metadata[event.MetadataID]; !ok || id == parent[event.MetadataID] {
+		metadata[event.MetadataID] = uuid.NewString()
+	}
+
+	metadata[event.MetadataParentID] = parent[event.MetadataID]
+	delete(metadata, event.MetadataRetryCount)
+
+	e := event.Event{Metadata: metadata, Payload: exported["payload"]}
+
+	names, err := f.sinkNames(opts["sink"])
+	if err != nil {
+		return err
+	}
+	e.Sinks = names
+
+	if key, ok := opts["key"]; ok && key != nil {
+		e.Key = fmt.Sprint(key)
+	}
+
+	d.emitted = append(d.emitted, e)
+
+	return nil
+}
+
+// decide records the outcome of the event, the first call to ok, drop or
+// error wins.
+func (f *runtimeCtx) decide(outcome event.Outcome, value sobek.Value) (*decision, error) {
+	var exported any
+	if value != nil && !sobek.IsUndefined(value) && !sobek.IsNull(value) {
+		exported = value.Export()
+	}
+
+	d, err := f.decisionFor(exported)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.outcome != nil {
+		return d, nil
+	}
+
+	e, err := eventFrom(exported, d.envelope)
+	if err != nil {
+		return nil, err
+	}
+
+	outcome.Event = e
+	d.outcome = &outcome
+
+	return d, nil
+}
+
+// decisionFor returns the decision of the event passed to ok, drop, error or
+// emit. Outside of handleBatch it is always the current event, batches find
+// the event by id.
+func (f *runtimeCtx) decisionFor(value any) (*decision, error) {
+	if len(f.decisions) == 0 {
+		return nil, fmt.Errorf("no event is being handled")
+	}
+
+	if f.batch == nil {
+		return f.decisions[0], nil
+	}
+
+	if value == nil {
+		return nil, fmt.Errorf("handleBatch must pass the event")
+	}
+
+	exported, ok := value.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("event must be an object with metadata and payload")
+	}
+
+	metadata, _ := exported["metadata"].(map[string]any)
+
+	d, ok := f.batch[fmt.Sprint(metadata[event.MetadataID])]
+	if !ok {
+		return nil, fmt.Errorf("event %v is not part of the batch", metadata[event.MetadataID])
+	}
+
+	return d, nil
+}
+
+// eventFrom converts the event passed to ok, drop or error back to an
+// event.Event, falling back to the envelope of the event.
+func eventFrom(value any, envelope map[string]any) (event.Event, error) {
+	if value == nil {
+		return toEvent(envelope)
+	}
+
+	exported, ok := value.(map[string]any)
+	if !ok {
+		return event.Event{}, fmt.Errorf("event must be an object with metadata and payload")
+	}
+
+	return toEvent(exported)
+}
+
+func toEvent(envelope map[string]any) (event.Event, error) {
+	metadata, ok := envelope["metadata"].(map[string]any)
+	if !ok {
+		return event.Event{}, fmt.Errorf("event metadata must be an object")
+	}
+
+	return event.Event{Metadata: metadata, Payload: envelope["payload"]}, nil
+}
+
+// result is the outcome of the invocation, handlers that return without
+// calling ok, drop or error forward the current event.
+func (f *runtimeCtx) result() (event.Outcome, error) {
+	return f.decisions[0].result()
+}
+
+// results are the outcomes of the events of a handleBatch invocation in
+// order, events without a decision are forwarded.
+func (f *runtimeCtx) results() ([]event.Outcome, error) {
+	outcomes := make([]event.Outcome, len(f.decisions))
+
+	for i, d := range f.decisions {
+		outcome, err := d.result()
+		if err != nil {
+			return nil, err
+		}
+		outcomes[i] = outcome
+	}
+
+	return outcomes, nil
+}
+
+func (d *decision) result() (event.Outcome, error) {
+	if d.outcome != nil {
+		outcome := *d.outcome
+		outcome.Emitted = d.emitted
+		return outcome, nil
+	}
+
+	e, err := toEvent(d.envelope)
+	return event.Outcome{Action: event.Ok, Event: e, Emitted: d.emitted}, err
 }
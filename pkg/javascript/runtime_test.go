@@ -0,0 +1,218 @@
+package javascript
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/JayJamieson/dbscript/pkg/event"
+)
+
+func TestRuntimeContext(t *testing.T) {
+	tests := []struct {
+		name     string
+		script   string
+		action   event.Action
+		newEvent bool
+		check    func(t *testing.T, outcome event.Outcome)
+	}{
+		{
+			name: "ok forwards modified event",
+			script: `function handle() {
+				var event = dbscript.ctx.getEvent();
+				event.metadata["my-key"] = "my value";
+				event.payload.after.email = "redacted";
+				dbscript.ctx.ok(event);
+			}`,
+			action: event.Ok,
+			check: func(t *testing.T, outcome event.Outcome) {
+				if outcome.Event.Metadata["my-key"] != "my value" {
+					t.Errorf("metadata my-key = %v, expected %q", outcome.Event.Metadata["my-key"], "my value")
+				}
+				after := outcome.Event.Payload.(map[string]any)["after"].(map[string]any)
+				if after["email"] != "redacted" {
+					t.Errorf("payload.after.email = %v, expected %q", after["email"], "redacted")
+				}
+			},
+		},
+		{
+			name: "ok with new event",
+			script: `function handle() {
+				dbscript.ctx.ok({metadata: {id: "custom"}, payload: {hello: "world"}});
+			}`,
+			action:   event.Ok,
+			newEvent: true,
+			check: func(t *testing.T, outcome event.Outcome) {
+				if outcome.Event.Metadata["id"] != "custom" {
+					t.Errorf("metadata id = %v, expected %q", outcome.Event.Metadata["id"], "custom")
+				}
+				if outcome.Event.Payload.(map[string]any)["hello"] != "world" {
+					t.Errorf("payload = %v", outcome.Event.Payload)
+				}
+			},
+		},
+		{
+			name:   "implicit ok",
+			script: `function handle(event) { event.metadata.seen = true; }`,
+			action: event.Ok,
+			check: func(t *testing.T, outcome event.Outcome) {
+				if outcome.Event.Metadata["seen"] != true {
+					t.Errorf("metadata seen = %v, expected true", outcome.Event.Metadata["seen"])
+				}
+			},
+		},
+		{
+			name: "drop",
+			script: `function handle() {
+				var event = dbscript.ctx.getEvent();
+				dbscript.ctx.drop("not interesting", event);
+			}`,
+			action: event.Drop,
+			check: func(t *testing.T, outcome event.Outcome) {
+				if outcome.Reason != "not interesting" {
+					t.Errorf("Reason = %q, expected %q", outcome.Reason, "not interesting")
+				}
+			},
+		},
+		{
+			name: "emit fans out changed columns",
+			script: `function handle(event) {
+				var after = event.payload.after;
+				Object.keys(after).forEach(function (column) {
+					dbscript.ctx.emit({metadata: event.metadata, payload: {column: column, value: after[column]}}, {sink: "columns", key: after.id});
+				});
+				dbscript.ctx.drop("split");
+			}`,
+			action: event.Drop,
+			check: func(t *testing.T, outcome event.Outcome) {
+				if len(outcome.Emitted) != 2 {
+					t.Fatalf("len(Emitted) = %d, expected 2", len(outcome.Emitted))
+				}
+
+				ids := map[any]bool{}
+				for _, emitted := range outcome.Emitted {
+					if len(emitted.Sinks) != 1 || emitted.Sinks[0] != "columns" || emitted.Key != "1" {
+						t.Errorf("Sinks, Key = %v, %q, expected [columns], 1", emitted.Sinks, emitted.Key)
+					}
+					if emitted.Metadata[event.MetadataParentID] != outcome.Event.Metadata[event.MetadataID] {
+						t.Errorf("metadata parentId = %v, expected %v", emitted.Metadata[event.MetadataParentID], outcome.Event.Metadata[event.MetadataID])
+					}
+					if emitted.Metadata[event.MetadataSource] != "default" {
+						t.Errorf("metadata source = %v, expected default", emitted.Metadata[event.MetadataSource])
+					}
+					ids[emitted.Metadata[event.MetadataID]] = true
+				}
+
+				if len(ids) != 2 || ids[outcome.Event.Metadata[event.MetadataID]] {
+					t.Errorf("emitted ids = %v, expected two new ids", ids)
+				}
+			},
+		},
+		{
+			name: "emit new event",
+			script: `function handle() {
+				dbscript.ctx.emit({payload: {audit: true}});
+			}`,
+			action: event.Ok,
+			check: func(t *testing.T, outcome event.Outcome) {
+				if len(outcome.Emitted) != 1 {
+					t.Fatalf("len(Emitted) = %d, expected 1", len(outcome.Emitted))
+				}
+				emitted := outcome.Emitted[0]
+				if emitted.Metadata[event.MetadataID] == nil || emitted.Metadata[event.MetadataTimestamp] != int64(1234567890) {
+					t.Errorf("metadata = %v, expected an id and the timestamp of the current event", emitted.Metadata)
+				}
+				if emitted.Sinks != nil {
+					t.Errorf("Sinks = %v, expected the default sink", emitted.Sinks)
+				}
+			},
+		},
+		{
+			name: "ok routes to named sinks",
+			script: `function handle(event) {
+				dbscript.ctx.ok(event, ["columns", "audit"]);
+			}`,
+			action: event.Ok,
+			check: func(t *testing.T, outcome event.Outcome) {
+				if len(outcome.Event.Sinks) != 2 || outcome.Event.Sinks[0] != "columns" || outcome.Event.Sinks[1] != "audit" {
+					t.Errorf("Sinks = %v, expected [columns audit]", outcome.Event.Sinks)
+				}
+			},
+		},
+		{
+			name: "error wins over later ok",
+			script: `function handle() {
+				var event = dbscript.ctx.getEvent();
+				dbscript.ctx.error(new Error("Some error handling event"), event);
+				dbscript.ctx.ok(event);
+			}`,
+			action: event.Error,
+			check: func(t *testing.T, outcome event.Outcome) {
+				if outcome.Err == nil || outcome.Err.Error() != "Error: Some error handling event" {
+					t.Errorf("Err = %v", outcome.Err)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			js, err := New(Options{Script: tt.script, Sinks: []string{"columns", "audit"}})
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			e := createTestEvent()
+
+			outcome, err := js.Execute(e)
+			if err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+
+			if outcome.Action != tt.action {
+				t.Fatalf("Action = %v, expected %v", outcome.Action, tt.action)
+			}
+
+			if !tt.newEvent && outcome.Event.Metadata[event.MetadataID] != e.Metadata[event.MetadataID] {
+				t.Errorf("metadata id = %v, expected %v", outcome.Event.Metadata[event.MetadataID], e.Metadata[event.MetadataID])
+			}
+
+			tt.check(t, outcome)
+		})
+	}
+}
+
+func TestRuntimeContextUnknownSink(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+	}{
+		{"ok", `function handle(event) { dbscript.ctx.ok(event, "missing"); }`},
+		{"ok with names", `function handle(event) { dbscript.ctx.ok(event, ["audit", "missing"]); }`},
+		{"emit", `function handle(event) { dbscript.ctx.emit({payload: 1}, {sink: "missing"}); }`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			js, err := New(Options{Script: tt.script, Sinks: []string{"audit"}})
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			_, err = js.Execute(createTestEvent())
+			if err == nil || !strings.Contains(err.Error(), `unknown sink "missing"`) {
+				t.Errorf("Execute() error = %v, expected unknown sink", err)
+			}
+		})
+	}
+}
+
+func TestRuntimeContextInvalidEvent(t *testing.T) {
+	js, err := New(Options{Script: `function handle() { dbscript.ctx.ok("not an event"); }`})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	if _, err := js.Execute(createTestEvent()); err == nil {
+		t.Errorf("Execute() expected error for invalid event")
+	}
+}
@@ -0,0 +1,119 @@
+package javascript
+
+import (
+	"errors"
+	"time"
+
+	"github.com/JayJamieson/dbscript/pkg/event"
+	"github.com/JayJamieson/dbscript/pkg/state"
+	"github.com/grafana/sobek"
+)
+
+var errStateNotConfigured = errors.New("state is not configured")
+
+// State is dbscript.state, a key-value store that survives restarts. Writes
+// of an invocation are discarded when it errors so retries do not apply them
+// twice, and persisted together with the checkpoint of the event's source.
+type State struct {
+	store *state.Store
+
+	// tx holds the writes of the running invocation or init
+	tx *state.Tx
+}
+
+// begin starts the writes of an invocation, source is empty during init.
+func (s *State) begin(source string) {
+	if s.store != nil {
+		s.tx = s.store.Begin(source)
+	}
+}
+
+// end commits or rolls back the writes of the invocation.
+func (s *State) end(commit bool) {
+	if s.tx == nil {
+		return
+	}
+
+	if commit {
+		s.tx.Commit()
+	} else {
+		s.tx.Rollback()
+	}
+
+	s.tx = nil
+}
+
+// written reports whether the running invocation wrote state.
+func (s *State) written() bool {
+	return s.tx != nil && s.tx.Writes() > 0
+}
+
+func (s *State) current() (*state.Tx, error) {
+	if s.store == nil {
+		return nil, errStateNotConfigured
+	}
+
+	if s.tx == nil {
+		return nil, errors.New("state is only available in init and handle")
+	}
+
+	return s.tx, nil
+}
+
+// Get returns the value stored at key, undefined when missing or expired.
+func (s *State) Get(key string) (any, error) {
+	tx, err := s.current()
+	if err != nil {
+		return nil, err
+	}
+
+	value, ok, err := tx.Get(key)
+	if err != nil || !ok {
+		return sobek.Undefined(), err
+	}
+
+	return value, nil
+}
+
+// Set stores a JSON encodable value, ttl is in milliseconds and never expires
+// when omitted.
+func (s *State) Set(key string, value any, ttl int64) error {
+	tx, err := s.current()
+	if err != nil {
+		return err
+	}
+
+	return tx.Set(key, value, time.Duration(ttl)*time.Millisecond)
+}
+
+// Delete removes key.
+func (s *State) Delete(key string) error {
+	tx, err := s.current()
+	if err != nil {
+		return err
+	}
+
+	tx.Delete(key)
+	return nil
+}
+
+// Incr adds by, 1 when omitted, to the number at key and returns the result.
+func (s *State) Incr(key string, by sobek.Value, ttl int64) (float64, error) {
+	tx, err := s.current()
+	if err != nil {
+		return 0, err
+	}
+
+	n := 1.0
+	if by != nil && !sobek.IsUndefined(by) && !sobek.IsNull(by) {
+		n = by.ToFloat()
+	}
+
+	return tx.Incr(key, n, time.Duration(ttl)*time.Millisecond)
+}
+
+// sourceOf returns the source an event was read from.
+func sourceOf(e event.Event) string {
+	source, _ := e.Metadata[event.MetadataSource].(string)
+	return source
+}
@@ -0,0 +1,174 @@
+package javascript
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/JayJamieson/dbscript/pkg/event"
+	"github.com/JayJamieson/dbscript/pkg/state"
+)
+
+func TestState(t *testing.T) {
+	store, err := state.Open(filepath.Join(t.TempDir(), "state.db"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer store.Close()
+
+	js, err := New(Options{
+		State: store,
+		Script: `
+			function init() {
+				dbscript.state.set("started", true);
+			}
+
+			function handle(event) {
+				var count = dbscript.state.incr("count:" + event.payload.after.id);
+				event.metadata.count = count;
+				event.metadata.started = dbscript.state.get("started");
+				event.metadata.missing = dbscript.state.get("missing") === undefined;
+
+				if (event.metadata.retryCount === undefined) {
+					dbscript.ctx.error("retry me");
+				}
+			}
+		`,
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	e := createTestEvent()
+
+	outcome, err := js.Execute(e)
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	if outcome.Action != event.Error {
+		t.Fatalf("Action = %v, expected Error", outcome.Action)
+	}
+
+	// the errored attempt's increment is discarded
+	outcome, err = js.Execute(e.WithRetryCount(1))
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	expected := map[string]any{"count": int64(1), "started": true, "missing": true}
+
+	for key, value := range expected {
+		if outcome.Event.Metadata[key] != value {
+			t.Errorf("metadata[%q] = %#v, expected %#v", key, outcome.Event.Metadata[key], value)
+		}
+	}
+}
+
+func TestStateNotConfigured(t *testing.T) {
+	js, err := New(Options{Script: `function handle(event) { dbscript.state.get("key"); }`})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	_, err = js.Execute(createTestEvent())
+	if err == nil || !strings.Contains(err.Error(), "state is not configured") {
+		t.Errorf("Execute() error = %v, expected state is not configured", err)
+	}
+}
+
+func TestStateBatch(t *testing.T) {
+	store, err := state.Open(filepath.Join(t.TempDir(), "state.db"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer store.Close()
+
+	js, err := New(Options{
+		State: store,
+		Script: `
+			function handleBatch(events) {
+				events.forEach(function (event) {
+					var count = dbscript.state.incr("count");
+
+					if (event.payload.table === "orders") {
+						dbscript.ctx.error("retry me", event);
+					} else {
+						event.metadata.count = count;
+						dbscript.ctx.ok(event);
+					}
+				});
+			}
+		`,
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	// the batch is retried as a whole, its increments are discarded
+	_, err = js.ExecuteBatch([]event.Event{createTableEvent("user", "INSERT"), createTableEvent("orders", "INSERT")})
+	if err == nil || !strings.Contains(err.Error(), "retry me") {
+		t.Fatalf("ExecuteBatch() error = %v, expected retry me", err)
+	}
+
+	outcome, err := js.Execute(createTableEvent("user", "INSERT"))
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	if count := outcome.Event.Metadata["count"]; count != int64(1) {
+		t.Errorf("count = %#v, expected 1", count)
+	}
+}
+
+func TestStateShutdown(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.db")
+
+	store, err := state.Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	js, err := New(Options{
+		State: store,
+		Script: `
+			var buffered = 0;
+
+			function handle(event) { buffered++; }
+
+			function shutdown() { dbscript.state.incr("count", buffered); }
+		`,
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	if _, err := js.Execute(createTestEvent()); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	if err := js.Shutdown(); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+
+	// dbscript start flushes the store before closing it
+	if err := store.Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	store.Close()
+
+	store, err = state.Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer store.Close()
+
+	count, ok, err := store.Begin("").Get("count")
+	if err != nil || !ok {
+		t.Fatalf("Get() = %v, %v", ok, err)
+	}
+
+	if count != float64(1) {
+		t.Errorf("count = %#v, expected 1", count)
+	}
+}
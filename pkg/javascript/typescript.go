@@ -0,0 +1,84 @@
+package javascript
+
+import (
+	"crypto/sha256"
+	"path/filepath"
+	"sync"
+
+	"github.com/evanw/esbuild/pkg/api"
+)
+
+// transpileTarget is the newest syntax passed through to the VM unchanged,
+// newer syntax is lowered.
+const transpileTarget = api.ES2017
+
+// transpiled caches the output of transpile by file name so reloads only
+// transpile the files that changed.
+var transpiled = struct {
+	sync.Mutex
+	entries map[string]transpileEntry
+}{entries: make(map[string]transpileEntry)}
+
+type transpileEntry struct {
+	sum  [sha256.Size]byte
+	code string
+}
+
+// loaderOf returns the esbuild loader of a file, JavaScript unless it is
+// TypeScript.
+func loaderOf(name string) api.Loader {
+	switch filepath.Ext(name) {
+	case ".ts", ".mts", ".cts":
+		return api.LoaderTS
+	}
+
+	return api.LoaderJS
+}
+
+// transpile converts TypeScript, and JavaScript syntax newer than
+// transpileTarget, to JavaScript the VM can run. The output
+// carries an inline source map so stack traces point at the original lines.
+// Syntax errors are returned as a *CompileError.
+func transpile(name, source string) (string, error) {
+	sum := sha256.Sum256([]byte(source))
+
+	transpiled.Lock()
+	entry, ok := transpiled.entries[name]
+	transpiled.Unlock()
+
+	if ok && entry.sum == sum {
+		return entry.code, nil
+	}
+
+	result := api.Transform(source, api.TransformOptions{
+		Loader:         loaderOf(name),
+		Target:         transpileTarget,
+		Sourcefile:     name,
+		Sourcemap:      api.SourceMapInline,
+		SourcesContent: api.SourcesContentExclude,
+		LogLevel:       api.LogLevelSilent,
+	})
+
+	if len(result.Errors) > 0 {
+		return "", newTranspileError(name, result.Errors[0])
+	}
+
+	code := string(result.Code)
+
+	transpiled.Lock()
+	transpiled.entries[name] = transpileEntry{sum: sum, code: code}
+	transpiled.Unlock()
+
+	return code, nil
+}
+
+func newTranspileError(name string, msg api.Message) error {
+	err := &CompileError{File: name, Message: msg.Text}
+
+	if msg.Location != nil {
+		err.Line = msg.Location.Line
+		err.Column = msg.Location.Column + 1
+	}
+
+	return err
+}
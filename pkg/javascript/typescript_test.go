@@ -0,0 +1,155 @@
+package javascript
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestTypeScriptHandler(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"handler.ts": `
+			import { domain } from "./lib/email";
+
+			interface Envelope {
+				metadata: Record<string, unknown>;
+				payload: { after?: { email?: string } };
+			}
+
+			export function handle(event: Envelope): void {
+				event.metadata.domain = domain(event.payload.after?.email ?? "");
+			}
+		`,
+		"lib/email.ts": `
+			export const domain = (email: string): string => email.split("@")[1];
+		`,
+	})
+
+	js, err := loadHandler(t, dir, "handler.ts")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	outcome, err := js.Execute(createTestEvent())
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	if domain := outcome.Event.Metadata["domain"]; domain != "example.com" {
+		t.Errorf("domain = %v, expected %v", domain, "example.com")
+	}
+}
+
+func TestJavaScriptLowered(t *testing.T) {
+	// async generators and for await are ES2018, sobek does not parse them
+	dir := writeModules(t, map[string]string{
+		"handler.js": `
+			const { ids } = require("./lib/ids.js");
+
+			async function handle(event) {
+				const { after: { id, ...rest } } = event.payload;
+				const seen = [];
+
+				for await (const n of ids(id)) {
+					seen.push(n);
+				}
+
+				event.metadata.seen = seen.join(",");
+				event.metadata.rest = Object.keys(rest).length;
+			}
+		`,
+		"lib/ids.js": `
+			exports.ids = async function* (id) {
+				yield id;
+				yield id + 1;
+			};
+		`,
+	})
+
+	js, err := loadHandler(t, dir, "handler.js")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	outcome, err := js.Execute(createTestEvent())
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	if seen := outcome.Event.Metadata["seen"]; seen != "1,2" {
+		t.Errorf("seen = %v, expected %v", seen, "1,2")
+	}
+
+	if rest := outcome.Event.Metadata["rest"]; rest != int64(1) {
+		t.Errorf("rest = %v, expected 1", rest)
+	}
+}
+
+func TestTypeScriptStackTrace(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"handler.ts": `type Row = { id: number };
+
+interface Envelope {
+	payload: { after: Row };
+}
+
+function handle(event: Envelope): void {
+	throw new Error("bad row " + event.payload.after.id);
+}
+`,
+	})
+
+	js, err := loadHandler(t, dir, "handler.ts")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	_, err = js.Execute(createTestEvent())
+
+	var exception *ExceptionError
+	if !errors.As(err, &exception) {
+		t.Fatalf("Execute() error = %T %v, expected *ExceptionError", err, err)
+	}
+
+	if !strings.Contains(exception.Stack, "handler.ts:8:") {
+		t.Errorf("Stack = %q, expected it to point at handler.ts:8", exception.Stack)
+	}
+}
+
+func TestTypeScriptCompileError(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"handler.ts": "function handle(event: ) {}\n",
+	})
+
+	_, err := loadHandler(t, dir, "handler.ts")
+
+	var compileErr *CompileError
+	if !errors.As(err, &compileErr) {
+		t.Fatalf("New() error = %T %v, expected *CompileError", err, err)
+	}
+
+	if compileErr.Line != 1 || compileErr.Column != 24 {
+		t.Errorf("position = %d:%d, expected 1:24", compileErr.Line, compileErr.Column)
+	}
+}
+
+func TestTranspileCache(t *testing.T) {
+	first, err := transpile("cached.ts", "const a: number = 1;")
+	if err != nil {
+		t.Fatalf("transpile() error = %v", err)
+	}
+
+	transpiled.Lock()
+	entry := transpiled.entries["cached.ts"]
+	entry.code = "cached"
+	transpiled.entries["cached.ts"] = entry
+	transpiled.Unlock()
+
+	if code, _ := transpile("cached.ts", "const a: number = 1;"); code != "cached" {
+		t.Errorf("transpile() = %q, expected the cached output", code)
+	}
+
+	if code, _ := transpile("cached.ts", "const a: number = 2;"); code == "cached" || code == first {
+		t.Errorf("transpile() = %q, expected changed source to be transpiled again", code)
+	}
+}
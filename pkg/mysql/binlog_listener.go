@@ -2,94 +2,325 @@ package mysql
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-mysql-org/go-mysql/canal"
 	"github.com/go-mysql-org/go-mysql/mysql"
 )
 
+// savepointInterval is how often non forced positions are checkpointed.
+const savepointInterval = 3 * time.Second
+
 type BinlogListener struct {
 	canal  *canal.Canal
 	Logger *slog.Logger
 
+	name          string
+	serverID      uint32
+	localhost     string
+	flavor        string
+	checkpoint    CheckpointStore
 	myslqPosition mysql.Position
+	gtid          mysql.GTIDSet
 	lastSave      time.Time
 
+	heartbeatPeriod    time.Duration
+	emitHeartbeats     bool
+	lastEventTimestamp atomic.Uint32
+	rowsSinceHeartbeat atomic.Bool
+	lag                atomic.Pointer[Lag]
+
+	// mu orders starting the background goroutines in Listen with Close,
+	// they are never started once the listener is closed
+	mu     sync.Mutex
 	wg     sync.WaitGroup
 	ctx    context.Context
 	cancel context.CancelFunc
 
 	eventCh             chan []RowChangeEvent
 	mysqlPositionSaveCh chan mysqlPosition
+
+	// rowBatches counts the row batches sent on eventCh, it is only used by
+	// the canal goroutine
+	rowBatches uint64
 }
 
 type BinlogListenerOptions struct {
+	// Name identifies the source, every event produced by the listener is
+	// tagged with it.
+	Name     string
 	Host     string
 	Port     int
 	User     string
 	Schema   string
 	Tables   []string
 	Password string
+
+	// ServerID is the replication server ID, it must be unique across every
+	// replica of the server. When zero a stable ID is derived from the
+	// hostname and Name.
+	ServerID uint32
+
+	TLS TLSOptions
+
+	// Flavor is mysql, mariadb or auto. Auto, the default, detects the
+	// flavor from the server version.
+	Flavor string
+
+	// HeartbeatPeriod is how often the server sends heartbeats on an idle
+	// stream and replication lag is measured. Defaults to 10 seconds.
+	HeartbeatPeriod time.Duration
+
+	// EmitHeartbeats sends a synthetic HEARTBEAT event every HeartbeatPeriod
+	// without row changes so idle sources still advance checkpoints
+	// downstream.
+	EmitHeartbeats bool
+
+	// CheckpointFile is where the binlog position is persisted. When empty
+	// the listener always starts from the current master position.
+	CheckpointFile string
+
+	// Checkpoint creates the store the binlog position is persisted to once
+	// the flavor is known, it takes precedence over CheckpointFile.
+	Checkpoint func(flavor string) CheckpointStore
 }
 
 func NewBinlogListener(opt *BinlogListenerOptions) (*BinlogListener, error) {
 	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
 
+	if opt.Name != "" {
+		logger = logger.With("source", opt.Name)
+	}
+
 	cfg := canal.NewDefaultConfig()
 	cfg.Addr = fmt.Sprintf("%s:%d", opt.Host, opt.Port)
 	cfg.User = opt.User
 	cfg.Password = opt.Password
 	cfg.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	tlsConfig, err := newTLSConfig(opt.TLS, opt.Host)
+	if err != nil {
+		return nil, err
+	}
+	cfg.TLSConfig = tlsConfig
+
+	cfg.Flavor, err = resolveFlavor(cfg, opt.Flavor)
+	if err != nil {
+		return nil, err
+	}
+
 	// disable dumping
 	// does not work on mysql >8.x
 	cfg.Dump.ExecutionPath = ""
 
-	for _, table := range opt.Tables {
-		cfg.IncludeTableRegex = append(cfg.IncludeTableRegex, opt.Schema+"\\."+table)
+	cfg.ServerID = opt.ServerID
+	if cfg.ServerID == 0 {
+		cfg.ServerID = defaultServerID(opt.Name)
+	}
+	cfg.Localhost = replicaHostname()
+
+	cfg.HeartbeatPeriod = opt.HeartbeatPeriod
+	if cfg.HeartbeatPeriod <= 0 {
+		cfg.HeartbeatPeriod = defaultHeartbeatPeriod
 	}
 
+	cfg.IncludeTableRegex = tableRegex(opt.Schema, opt.Tables)
+
 	canal, err := canal.NewCanal(cfg)
 
 	if err != nil {
 		return nil, err
 	}
 
-	coords, err := canal.GetMasterPos()
+	listener := &BinlogListener{}
+	listener.canal = canal
+	listener.Logger = logger
+	listener.name = opt.Name
+	listener.serverID = cfg.ServerID
+	listener.localhost = cfg.Localhost
+	listener.flavor = cfg.Flavor
+	listener.heartbeatPeriod = cfg.HeartbeatPeriod
+	listener.emitHeartbeats = opt.EmitHeartbeats
 
-	if err != nil {
+	if err := checkServerID(canal, listener.serverID, listener.localhost, true); err != nil {
 		canal.Close()
 		return nil, err
 	}
 
-	listener := &BinlogListener{}
-	listener.canal = canal
-	listener.Logger = logger
-	listener.myslqPosition = coords
+	switch {
+	case opt.Checkpoint != nil:
+		listener.checkpoint = opt.Checkpoint(listener.flavor)
+	case opt.CheckpointFile != "":
+		listener.checkpoint = NewCheckpoint(opt.CheckpointFile, listener.flavor)
+	}
+
+	if err := listener.startPosition(); err != nil {
+		canal.Close()
+		return nil, err
+	}
 
 	listener.eventCh = make(chan []RowChangeEvent, 4096)
 	listener.mysqlPositionSaveCh = make(chan mysqlPosition, 4096)
 	listener.ctx, listener.cancel = context.WithCancel(context.Background())
 
 	canal.SetEventHandler(listener)
+	listener.publishLag()
 
 	return listener, nil
 }
 
-func (l *BinlogListener) Listen() error {
+// startPosition resumes from the checkpoint when one exists, otherwise from
+// the current master position. MariaDB sources always replicate by GTID.
+func (l *BinlogListener) startPosition() error {
+	if l.checkpoint != nil {
+		pos, gtid, ok, err := l.checkpoint.Load()
+
+		if err != nil {
+			return fmt.Errorf("loading checkpoint: %w", err)
+		}
+
+		if ok {
+			if l.flavor == mysql.MariaDBFlavor && gtid == nil {
+				return fmt.Errorf("checkpoint %s has no GTID set, required for MariaDB sources", l.checkpoint)
+			}
+
+			l.Logger.Info("Resuming from checkpoint", "position", pos.String(), "gtid", gtidString(gtid))
+			l.myslqPosition = pos
+			l.gtid = gtid
+			return nil
+		}
+	}
+
+	if l.flavor == mysql.MariaDBFlavor {
+		gtid, err := currentGTIDSet(l.canal)
+		if err != nil {
+			return fmt.Errorf("reading current GTID set: %w", err)
+		}
+
+		l.gtid = gtid
+		return nil
+	}
+
+	pos, err := l.canal.GetMasterPos()
+	if err != nil {
+		return err
+	}
+
+	l.myslqPosition = pos
+	return nil
+}
+
+func gtidString(gtid mysql.GTIDSet) string {
+	if gtid == nil {
+		return ""
+	}
+
+	return gtid.String()
+}
+
+// run starts replication from the GTID set when known, otherwise from the
+// binlog position.
+func (l *BinlogListener) run() error {
+	if l.gtid != nil {
+		return l.canal.StartFromGTID(l.gtid)
+	}
+
 	return l.canal.RunFrom(l.myslqPosition)
 }
 
+func (l *BinlogListener) Listen() error {
+	conflict := make(chan error, 1)
+
+	l.mu.Lock()
+	if err := l.ctx.Err(); err != nil {
+		l.mu.Unlock()
+		return err
+	}
+
+	l.wg.Add(2)
+	go l.watchServerID(conflict)
+	go l.monitorLag()
+	l.mu.Unlock()
+
+	err := l.run()
+
+	select {
+	case cerr := <-conflict:
+		return cerr
+	default:
+	}
+
+	if isServerIDConflict(err) {
+		return &ServerIDConflictError{ServerID: l.serverID}
+	}
+
+	return err
+}
+
+// watchServerID periodically checks no other replica took over our server ID,
+// MySQL silently drops the older connection and the two replicas would keep
+// reconnecting and disconnecting each other.
+func (l *BinlogListener) watchServerID(conflict chan<- error) {
+	defer l.wg.Done()
+
+	ticker := time.NewTicker(serverIDCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.ctx.Done():
+			return
+		case <-ticker.C:
+			err := checkServerID(l.canal, l.serverID, l.localhost, false)
+
+			var conflictErr *ServerIDConflictError
+			if errors.As(err, &conflictErr) {
+				l.Logger.Error("Replication server ID conflict", "error", err)
+				conflict <- err
+				l.cancel()
+				l.canal.Close()
+				return
+			}
+
+			if err != nil {
+				l.Logger.Warn("Checking replication server ID", "error", err)
+			}
+		}
+	}
+}
+
 func (l *BinlogListener) Close() {
 	l.Logger.Info("Closing dbscript")
 
+	l.mu.Lock()
 	l.cancel()
+	l.mu.Unlock()
 
 	l.canal.Close()
+
+	l.wg.Wait()
+}
+
+// ServerID returns the replication server ID the listener registers with.
+func (l *BinlogListener) ServerID() uint32 {
+	return l.serverID
+}
+
+// Flavor returns the server flavor, mysql or mariadb.
+func (l *BinlogListener) Flavor() string {
+	return l.flavor
+}
+
+// Name returns the source name the listener was created with.
+func (l *BinlogListener) Name() string {
+	return l.name
 }
 
 func (l *BinlogListener) GetEventStream() <-chan []RowChangeEvent {
@@ -99,3 +330,23 @@ func (l *BinlogListener) GetEventStream() <-chan []RowChangeEvent {
 func (l *BinlogListener) GetSavepointStream() <-chan mysqlPosition {
 	return l.mysqlPositionSaveCh
 }
+
+// Commit persists a savepoint once every event before it has been processed.
+// Forced savepoints are always written, others at most every savepointInterval.
+func (l *BinlogListener) Commit(sp mysqlPosition) error {
+	if l.checkpoint == nil {
+		return nil
+	}
+
+	if !sp.force && time.Since(l.lastSave) < savepointInterval {
+		return nil
+	}
+
+	if err := l.checkpoint.Save(sp.pos, sp.gtid); err != nil {
+		return fmt.Errorf("saving checkpoint: %w", err)
+	}
+
+	l.lastSave = time.Now()
+
+	return nil
+}
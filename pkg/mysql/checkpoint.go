@@ -0,0 +1,120 @@
+package mysql
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+// CheckpointStore persists the last processed binlog position of a source.
+type CheckpointStore interface {
+	// Load returns the saved position and GTID set, gtid is nil when only a
+	// position was saved. ok is false when nothing has been saved yet.
+	Load() (pos mysql.Position, gtid mysql.GTIDSet, ok bool, err error)
+
+	// Save replaces the saved position, gtid may be nil.
+	Save(pos mysql.Position, gtid mysql.GTIDSet) error
+
+	// String describes where positions are saved for error messages.
+	String() string
+}
+
+// Checkpoint persists the last processed binlog position of a source to a file
+// so processing resumes where it left off after a restart.
+// The GTID set is saved alongside the position when the server provides one,
+// it is required to resume MariaDB sources.
+type Checkpoint struct {
+	path   string
+	flavor string
+}
+
+type checkpointFile struct {
+	Name string `json:"name"`
+	Pos  uint32 `json:"pos"`
+	GTID string `json:"gtid,omitempty"`
+}
+
+func NewCheckpoint(path string, flavor string) *Checkpoint {
+	return &Checkpoint{path: path, flavor: flavor}
+}
+
+// Load returns the saved position and GTID set, gtid is nil when only a
+// position was saved. ok is false when nothing has been saved yet.
+func (c *Checkpoint) Load() (pos mysql.Position, gtid mysql.GTIDSet, ok bool, err error) {
+	data, err := os.ReadFile(c.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return pos, nil, false, nil
+	}
+	if err != nil {
+		return pos, nil, false, err
+	}
+
+	return UnmarshalCheckpoint(data, c.flavor)
+}
+
+// String returns the checkpoint file path.
+func (c *Checkpoint) String() string {
+	return c.path
+}
+
+// Save atomically replaces the saved position, gtid may be nil.
+func (c *Checkpoint) Save(pos mysql.Position, gtid mysql.GTIDSet) error {
+	data, err := MarshalCheckpoint(pos, gtid)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), filepath.Base(c.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), c.path)
+}
+
+// MarshalCheckpoint encodes a position and optional GTID set the way
+// checkpoint files store them.
+func MarshalCheckpoint(pos mysql.Position, gtid mysql.GTIDSet) ([]byte, error) {
+	file := checkpointFile{Name: pos.Name, Pos: pos.Pos}
+	if gtid != nil {
+		file.GTID = gtid.String()
+	}
+
+	return json.Marshal(file)
+}
+
+// UnmarshalCheckpoint decodes data written by MarshalCheckpoint, ok is always
+// true when err is nil.
+func UnmarshalCheckpoint(data []byte, flavor string) (pos mysql.Position, gtid mysql.GTIDSet, ok bool, err error) {
+	var file checkpointFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return pos, nil, false, err
+	}
+
+	if file.GTID != "" {
+		gtid, err = mysql.ParseGTIDSet(flavor, file.GTID)
+		if err != nil {
+			return pos, nil, false, err
+		}
+	}
+
+	return mysql.Position{Name: file.Name, Pos: file.Pos}, gtid, true, nil
+}
@@ -0,0 +1,75 @@
+package mysql
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+func TestCheckpoint(t *testing.T) {
+	tests := []struct {
+		name   string
+		flavor string
+		pos    mysql.Position
+		gtid   string
+	}{
+		{
+			name:   "position only",
+			flavor: mysql.MySQLFlavor,
+			pos:    mysql.Position{Name: "binlog.000003", Pos: 1234},
+		},
+		{
+			name:   "mysql gtid",
+			flavor: mysql.MySQLFlavor,
+			pos:    mysql.Position{Name: "binlog.000003", Pos: 1234},
+			gtid:   "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5",
+		},
+		{
+			name:   "mariadb gtid",
+			flavor: mysql.MariaDBFlavor,
+			pos:    mysql.Position{Name: "mariadb-bin.000001", Pos: 330},
+			gtid:   "0-1-42,1-2-7",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkpoint := NewCheckpoint(filepath.Join(t.TempDir(), "source.pos"), tt.flavor)
+
+			_, _, ok, err := checkpoint.Load()
+			if err != nil || ok {
+				t.Fatalf("Load() before Save ok = %v, err = %v, expected false, nil", ok, err)
+			}
+
+			var gtid mysql.GTIDSet
+			if tt.gtid != "" {
+				gtid, err = mysql.ParseGTIDSet(tt.flavor, tt.gtid)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := checkpoint.Save(tt.pos, gtid); err != nil {
+				t.Fatalf("Save() error = %v", err)
+			}
+
+			pos, loaded, ok, err := checkpoint.Load()
+			if err != nil || !ok {
+				t.Fatalf("Load() ok = %v, err = %v", ok, err)
+			}
+
+			if pos != tt.pos {
+				t.Errorf("Load() position = %v, expected %v", pos, tt.pos)
+			}
+
+			if tt.gtid == "" && loaded != nil {
+				t.Errorf("Load() gtid = %v, expected nil", loaded)
+			}
+
+			if tt.gtid != "" && (loaded == nil || !loaded.Equal(gtid)) {
+				t.Errorf("Load() gtid = %v, expected %v", loaded, gtid)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package mysql
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-mysql-org/go-mysql/canal"
+	"github.com/go-mysql-org/go-mysql/client"
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+// FlavorAuto detects the server flavor from SELECT VERSION().
+const FlavorAuto = "auto"
+
+// resolveFlavor validates the configured flavor, connecting to the server to
+// detect it when set to auto or left empty.
+func resolveFlavor(cfg *canal.Config, flavor string) (string, error) {
+	switch flavor {
+	case mysql.MySQLFlavor, mysql.MariaDBFlavor:
+		return flavor, nil
+	case "", FlavorAuto:
+		return detectFlavor(cfg)
+	default:
+		return "", fmt.Errorf("unsupported flavor %q, expected %s, %s or %s", flavor, mysql.MySQLFlavor, mysql.MariaDBFlavor, FlavorAuto)
+	}
+}
+
+func detectFlavor(cfg *canal.Config) (string, error) {
+	conn, err := client.Connect(cfg.Addr, cfg.User, cfg.Password, "", func(c *client.Conn) error {
+		if cfg.TLSConfig != nil {
+			c.SetTLSConfig(cfg.TLSConfig)
+		}
+		return nil
+	})
+
+	if err != nil {
+		return "", fmt.Errorf("detecting flavor: %w", err)
+	}
+
+	defer conn.Close()
+
+	rr, err := conn.Execute("SELECT VERSION()")
+	if err != nil {
+		return "", fmt.Errorf("detecting flavor: %w", err)
+	}
+
+	version, err := rr.GetString(0, 0)
+	if err != nil {
+		return "", fmt.Errorf("detecting flavor: %w", err)
+	}
+
+	return flavorFromVersion(version), nil
+}
+
+func flavorFromVersion(version string) string {
+	if strings.Contains(strings.ToLower(version), "mariadb") {
+		return mysql.MariaDBFlavor
+	}
+
+	return mysql.MySQLFlavor
+}
+
+// currentGTIDSet returns the GTID set of the last transaction written to the
+// MariaDB binlog, replication starts right after it.
+func currentGTIDSet(c *canal.Canal) (mysql.GTIDSet, error) {
+	rr, err := c.Execute("SELECT @@GLOBAL.gtid_binlog_pos")
+	if err != nil {
+		return nil, err
+	}
+
+	gtid, err := rr.GetString(0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return mysql.ParseGTIDSet(mysql.MariaDBFlavor, gtid)
+}
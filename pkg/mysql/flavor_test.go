@@ -0,0 +1,27 @@
+package mysql
+
+import (
+	"testing"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+func TestFlavorFromVersion(t *testing.T) {
+	tests := []struct {
+		version  string
+		expected string
+	}{
+		{"8.4.2", mysql.MySQLFlavor},
+		{"8.0.36-0ubuntu0.22.04.1", mysql.MySQLFlavor},
+		{"10.11.6-MariaDB-0+deb12u1-log", mysql.MariaDBFlavor},
+		{"5.5.5-10.6.16-MariaDB", mysql.MariaDBFlavor},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			if got := flavorFromVersion(tt.version); got != tt.expected {
+				t.Errorf("flavorFromVersion(%q) = %q, expected %q", tt.version, got, tt.expected)
+			}
+		})
+	}
+}
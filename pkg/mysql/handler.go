@@ -10,10 +10,21 @@ import (
 
 type mysqlPosition struct {
 	pos   mysql.Position
+	gtid  mysql.GTIDSet
 	force bool
+
+	// rowBatches is how many row batches were sent before the savepoint
+	rowBatches uint64
+}
+
+// RowBatches returns how many row batches the listener sent on its event
+// stream before the savepoint, heartbeats are not counted.
+func (sp mysqlPosition) RowBatches() uint64 {
+	return sp.rowBatches
 }
 
 type RowChangeEvent struct {
+	Source            string         `json:"source"`
 	Database          string         `json:"database"`
 	Table             string         `json:"table"`
 	Type              string         `json:"type"`
@@ -46,7 +57,18 @@ func (l *BinlogListener) OnRow(event *canal.RowsEvent) error {
 		return fmt.Errorf("action type %s err %w, closing listener", event.Action, err)
 	}
 
-	l.eventCh <- events
+	for i := range events {
+		events[i].Source = l.name
+	}
+
+	l.lastEventTimestamp.Store(event.Header.Timestamp)
+	l.rowsSinceHeartbeat.Store(true)
+
+	select {
+	case l.eventCh <- events:
+		l.rowBatches++
+	case <-l.ctx.Done():
+	}
 
 	return l.ctx.Err()
 }
@@ -59,14 +81,9 @@ func (l *BinlogListener) OnGTID(header *replication.EventHeader, gtidEvent mysql
 	return nil
 }
 
+// OnRotate and OnDDL are always followed by a forced OnPosSynced which
+// carries the GTID set as well, savepoints are only taken there.
 func (l *BinlogListener) OnRotate(event *replication.EventHeader, rotateEvent *replication.RotateEvent) error {
-	pos := mysql.Position{
-		Name: string(rotateEvent.NextLogName),
-		Pos:  uint32(rotateEvent.Position),
-	}
-
-	l.mysqlPositionSaveCh <- mysqlPosition{pos, true}
-
 	return l.ctx.Err()
 }
 
@@ -75,19 +92,36 @@ func (l *BinlogListener) OnTableChanged(*replication.EventHeader, string, string
 }
 
 func (l *BinlogListener) OnDDL(event *replication.EventHeader, pos mysql.Position, _ *replication.QueryEvent) error {
-	l.mysqlPositionSaveCh <- mysqlPosition{pos, true}
-
 	return l.ctx.Err()
 }
 
 func (l *BinlogListener) OnPosSynced(header *replication.EventHeader, pos mysql.Position, gtid mysql.GTIDSet, force bool) error {
-	return nil
+	if header != nil && header.Timestamp != 0 {
+		l.lastEventTimestamp.Store(header.Timestamp)
+	}
+
+	if gtid != nil {
+		gtid = gtid.Clone()
+	}
+
+	return l.savepoint(mysqlPosition{pos, gtid, force, l.rowBatches})
 }
 
 func (l *BinlogListener) OnRowsQueryEvent(*replication.RowsQueryEvent) error {
 	return nil
 }
 
+// savepoint queues a position for checkpointing without blocking once the
+// listener is closed.
+func (l *BinlogListener) savepoint(sp mysqlPosition) error {
+	select {
+	case l.mysqlPositionSaveCh <- sp:
+	case <-l.ctx.Done():
+	}
+
+	return l.ctx.Err()
+}
+
 func (l *BinlogListener) String() string {
 	return "BinlogListener"
 }
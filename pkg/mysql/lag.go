@@ -0,0 +1,147 @@
+package mysql
+
+import (
+	"expvar"
+	"fmt"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+// defaultHeartbeatPeriod is how often the server sends heartbeats and lag is
+// measured when not configured.
+const defaultHeartbeatPeriod = 10 * time.Second
+
+// HeartbeatEvent is the RowChangeEvent type of synthetic heartbeat events.
+const HeartbeatEvent = "HEARTBEAT"
+
+// replicationMetrics publishes the lag of every listener under the
+// "replication" expvar.
+var replicationMetrics = expvar.NewMap("replication")
+
+// Lag describes how far a listener is behind the server.
+type Lag struct {
+	Source string `json:"source"`
+
+	// Seconds since the last replicated event was written on the server,
+	// zero when the listener has caught up.
+	Seconds float64 `json:"seconds"`
+
+	// BytesBehind is the binlog distance to the server position, -1 when the
+	// server already moved on to a later binlog file.
+	BytesBehind int64 `json:"bytes_behind"`
+
+	Position       string    `json:"position"`
+	ServerPosition string    `json:"server_position"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// Lag returns the last measured replication lag.
+func (l *BinlogListener) Lag() Lag {
+	if lag := l.lag.Load(); lag != nil {
+		return *lag
+	}
+
+	return Lag{Source: l.name, BytesBehind: -1}
+}
+
+// measureLag compares the synced position against the server position and
+// the last event timestamp against the wall clock.
+func (l *BinlogListener) measureLag(now time.Time) (Lag, error) {
+	server, err := l.canal.GetMasterPos()
+	if err != nil {
+		return Lag{}, err
+	}
+
+	synced := l.canal.SyncedPosition()
+
+	return computeLag(l.name, synced, server, l.lastEventTimestamp.Load(), now), nil
+}
+
+func computeLag(source string, synced, server mysql.Position, lastEvent uint32, now time.Time) Lag {
+	lag := Lag{
+		Source:         source,
+		BytesBehind:    -1,
+		Position:       synced.String(),
+		ServerPosition: server.String(),
+		UpdatedAt:      now,
+	}
+
+	if synced.Name == server.Name {
+		lag.BytesBehind = max(int64(server.Pos)-int64(synced.Pos), 0)
+	}
+
+	if lag.BytesBehind == 0 || lastEvent == 0 {
+		return lag
+	}
+
+	if behind := now.Sub(time.Unix(int64(lastEvent), 0)); behind > 0 {
+		lag.Seconds = behind.Seconds()
+	}
+
+	return lag
+}
+
+// monitorLag measures lag every heartbeat period, logs and publishes it and
+// emits heartbeat events when enabled and no rows changed since the last tick.
+func (l *BinlogListener) monitorLag() {
+	defer l.wg.Done()
+
+	ticker := time.NewTicker(l.heartbeatPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.ctx.Done():
+			return
+		case now := <-ticker.C:
+			lag, err := l.measureLag(now)
+			if err != nil {
+				l.Logger.Warn("Measuring replication lag", "error", err)
+				continue
+			}
+
+			l.lag.Store(&lag)
+			l.Logger.Info("Replication lag",
+				"seconds", lag.Seconds,
+				"bytes_behind", lag.BytesBehind,
+				"position", lag.Position,
+				"server_position", lag.ServerPosition,
+			)
+
+			if l.emitHeartbeats && !l.rowsSinceHeartbeat.Swap(false) {
+				l.heartbeat(now)
+			}
+		}
+	}
+}
+
+// heartbeat sends a synthetic event carrying the synced position so idle
+// sources still advance checkpoints downstream.
+func (l *BinlogListener) heartbeat(now time.Time) {
+	pos := l.canal.SyncedPosition()
+
+	event := RowChangeEvent{
+		Source:    l.name,
+		Type:      HeartbeatEvent,
+		TimeStamp: uint32(now.Unix()),
+		Position:  fmt.Sprintf("%d", pos.Pos),
+		ServerID:  fmt.Sprintf("%d", l.serverID),
+	}
+
+	select {
+	case l.eventCh <- []RowChangeEvent{event}:
+	case <-l.ctx.Done():
+	}
+}
+
+func (l *BinlogListener) publishLag() {
+	name := l.name
+	if name == "" {
+		name = "default"
+	}
+
+	replicationMetrics.Set(name, expvar.Func(func() any {
+		return l.Lag()
+	}))
+}
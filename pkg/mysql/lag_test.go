@@ -0,0 +1,73 @@
+package mysql
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+func TestComputeLag(t *testing.T) {
+	now := time.Unix(1752569637, 0)
+
+	tests := []struct {
+		name        string
+		synced      mysql.Position
+		server      mysql.Position
+		lastEvent   uint32
+		seconds     float64
+		bytesBehind int64
+	}{
+		{
+			name:        "caught up",
+			synced:      mysql.Position{Name: "binlog.000001", Pos: 500},
+			server:      mysql.Position{Name: "binlog.000001", Pos: 500},
+			lastEvent:   uint32(now.Unix()) - 3600,
+			seconds:     0,
+			bytesBehind: 0,
+		},
+		{
+			name:        "behind in same file",
+			synced:      mysql.Position{Name: "binlog.000001", Pos: 500},
+			server:      mysql.Position{Name: "binlog.000001", Pos: 1500},
+			lastEvent:   uint32(now.Unix()) - 30,
+			seconds:     30,
+			bytesBehind: 1000,
+		},
+		{
+			name:        "behind in earlier file",
+			synced:      mysql.Position{Name: "binlog.000001", Pos: 500},
+			server:      mysql.Position{Name: "binlog.000002", Pos: 100},
+			lastEvent:   uint32(now.Unix()) - 90,
+			seconds:     90,
+			bytesBehind: -1,
+		},
+		{
+			name:        "no events yet",
+			synced:      mysql.Position{Name: "binlog.000001", Pos: 500},
+			server:      mysql.Position{Name: "binlog.000001", Pos: 900},
+			lastEvent:   0,
+			seconds:     0,
+			bytesBehind: 400,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lag := computeLag("shard1", tt.synced, tt.server, tt.lastEvent, now)
+
+			if lag.Source != "shard1" {
+				t.Errorf("Source = %q, expected %q", lag.Source, "shard1")
+			}
+			if lag.Seconds != tt.seconds {
+				t.Errorf("Seconds = %v, expected %v", lag.Seconds, tt.seconds)
+			}
+			if lag.BytesBehind != tt.bytesBehind {
+				t.Errorf("BytesBehind = %v, expected %v", lag.BytesBehind, tt.bytesBehind)
+			}
+			if lag.ServerPosition != tt.server.String() {
+				t.Errorf("ServerPosition = %q, expected %q", lag.ServerPosition, tt.server.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,346 @@
+package mysql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/client"
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+const (
+	// DefaultQueryMaxConns is the number of connections a QueryPool opens at
+	// most.
+	DefaultQueryMaxConns = 4
+
+	defaultConnectTimeout = 10 * time.Second
+)
+
+// ErrNotReadOnly is returned for statements other than SELECT, WITH ...
+// SELECT, SHOW, DESCRIBE and EXPLAIN, and for reads writing files or taking
+// locks.
+var ErrNotReadOnly = errors.New("only read-only statements are allowed")
+
+// QueryPool runs read-only queries against a source over pooled connections
+// separate from the replication connection. Connections are opened lazily
+// and their sessions are read-only.
+type QueryPool struct {
+	addr    string
+	options *BinlogListenerOptions
+
+	// slots limits the open connections, idle holds the ones not in use
+	slots  chan struct{}
+	idle   chan *client.Conn
+	closed atomic.Bool
+}
+
+// NewQueryPool creates a pool for the source a listener created with opt
+// replicates from, maxConns defaults to DefaultQueryMaxConns.
+func NewQueryPool(opt *BinlogListenerOptions, maxConns int) *QueryPool {
+	if maxConns <= 0 {
+		maxConns = DefaultQueryMaxConns
+	}
+
+	return &QueryPool{
+		addr:    fmt.Sprintf("%s:%d", opt.Host, opt.Port),
+		options: opt,
+		slots:   make(chan struct{}, maxConns),
+		idle:    make(chan *client.Conn, maxConns),
+	}
+}
+
+// Query runs a parameterized statement and returns its rows as maps keyed by
+// column name. Text and binary values are returned as strings. The query is
+// aborted, and its connection closed, when ctx is done.
+func (p *QueryPool) Query(ctx context.Context, query string, args ...any) ([]map[string]any, error) {
+	if !readOnly(query) {
+		return nil, ErrNotReadOnly
+	}
+
+	conn, err := p.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// closing the connection unblocks a query running past ctx
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	result, err := conn.Execute(query, args...)
+
+	close(done)
+	<-stopped
+
+	if ctx.Err() != nil {
+		p.drop(conn)
+		return nil, fmt.Errorf("query: %w", ctx.Err())
+	}
+
+	if err != nil {
+		// server errors leave the connection usable
+		var myErr *mysql.MyError
+		if errors.As(err, &myErr) {
+			p.put(conn)
+		} else {
+			p.drop(conn)
+		}
+		return nil, fmt.Errorf("query: %w", err)
+	}
+
+	defer result.Close()
+	p.put(conn)
+
+	return resultRows(result), nil
+}
+
+// Close closes the idle connections, connections in use are closed when
+// they are returned.
+func (p *QueryPool) Close() {
+	p.closed.Store(true)
+
+	for {
+		select {
+		case conn := <-p.idle:
+			p.drop(conn)
+		default:
+			return
+		}
+	}
+}
+
+func (p *QueryPool) get(ctx context.Context) (*client.Conn, error) {
+	select {
+	case conn := <-p.idle:
+		return conn, nil
+	default:
+	}
+
+	select {
+	case conn := <-p.idle:
+		return conn, nil
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, fmt.Errorf("query: waiting for a connection: %w", ctx.Err())
+	}
+
+	conn, err := p.connect(ctx)
+	if err != nil {
+		<-p.slots
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+func (p *QueryPool) connect(ctx context.Context) (*client.Conn, error) {
+	tlsConfig, err := newTLSConfig(p.options.TLS, p.options.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := defaultConnectTimeout
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = min(timeout, time.Until(deadline))
+	}
+
+	conn, err := client.ConnectWithContext(ctx, p.addr, p.options.User, p.options.Password, p.options.Schema, timeout, func(c *client.Conn) error {
+		if tlsConfig != nil {
+			c.SetTLSConfig(tlsConfig)
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("query: connecting to %s: %w", p.addr, err)
+	}
+
+	if _, err := conn.Execute("SET SESSION TRANSACTION READ ONLY"); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("query: %w", err)
+	}
+
+	return conn, nil
+}
+
+func (p *QueryPool) put(conn *client.Conn) {
+	if p.closed.Load() {
+		p.drop(conn)
+		return
+	}
+
+	select {
+	case p.idle <- conn:
+	default:
+		p.drop(conn)
+	}
+}
+
+func (p *QueryPool) drop(conn *client.Conn) {
+	conn.Close()
+	<-p.slots
+}
+
+// readOnly reports whether the statement is a plain read: a SELECT, SHOW,
+// DESCRIBE or EXPLAIN, or a WITH whose statement is a SELECT, without INTO,
+// FOR UPDATE, FOR SHARE or LOCK IN SHARE MODE. Read-only sessions only reject
+// data changes, SELECT ... INTO OUTFILE writes files and locking reads take
+// row locks on the source, so both are rejected here.
+func readOnly(query string) bool {
+	tokens := sqlTokens(query)
+
+	first := 0
+	for first < len(tokens) && tokens[first] == "(" {
+		first++
+	}
+
+	if first == len(tokens) {
+		return false
+	}
+
+	switch tokens[first] {
+	case "SELECT", "SHOW", "DESCRIBE", "DESC", "EXPLAIN":
+	case "WITH":
+		if statementAfterWith(tokens[first+1:]) != "SELECT" {
+			return false
+		}
+	default:
+		return false
+	}
+
+	for i, token := range tokens {
+		next := ""
+		if i+1 < len(tokens) {
+			next = tokens[i+1]
+		}
+
+		switch {
+		case token == "INTO":
+			return false
+		case token == "FOR" && (next == "UPDATE" || next == "SHARE"):
+			return false
+		case token == "LOCK" && next == "IN":
+			return false
+		}
+	}
+
+	return true
+}
+
+// statementAfterWith returns the keyword of the statement following the
+// common table expressions of a WITH clause.
+func statementAfterWith(tokens []string) string {
+	depth := 0
+
+	// closed is set once an expression or its column list ends
+	closed := false
+
+	for _, token := range tokens {
+		switch {
+		case token == "(" && closed && depth == 0:
+			// a parenthesized statement
+		case token == "(":
+			depth++
+		case token == ")":
+			depth--
+			closed = depth == 0
+		case depth > 0 || !closed:
+		case token == "," || token == "AS":
+			closed = false
+		default:
+			return token
+		}
+	}
+
+	return ""
+}
+
+// sqlTokens returns the upper cased words and the parentheses and commas of
+// a statement, skipping literals, quoted identifiers and comments.
+func sqlTokens(query string) []string {
+	var tokens []string
+
+	for i := 0; i < len(query); {
+		c := query[i]
+
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			i++
+			for i < len(query) && query[i] != c {
+				if query[i] == '\\' {
+					i++
+				}
+				i++
+			}
+			i++
+		case c == '#' || (c == '-' && strings.HasPrefix(query[i:], "-- ")):
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				return tokens
+			}
+			i += end
+		case c == '/' && strings.HasPrefix(query[i:], "/*"):
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				return tokens
+			}
+			i += end + 4
+		case c == '(' || c == ')' || c == ',':
+			tokens = append(tokens, string(c))
+			i++
+		case isWordStart(c):
+			start := i
+			for i < len(query) && (isWordStart(query[i]) || query[i] == '$' || ('0' <= query[i] && query[i] <= '9')) {
+				i++
+			}
+			tokens = append(tokens, strings.ToUpper(query[start:i]))
+		default:
+			i++
+		}
+	}
+
+	return tokens
+}
+
+func isWordStart(c byte) bool {
+	return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+func resultRows(result *mysql.Result) []map[string]any {
+	if result.Resultset == nil {
+		return []map[string]any{}
+	}
+
+	out := make([]map[string]any, 0, len(result.Values))
+
+	for _, values := range result.Values {
+		row := make(map[string]any, len(result.Fields))
+
+		for i, field := range result.Fields {
+			value := values[i].Value()
+
+			// copy, the result set buffers are reused
+			if data, ok := value.([]byte); ok {
+				value = string(data)
+			}
+
+			row[string(field.Name)] = value
+		}
+
+		out = append(out, row)
+	}
+
+	return out
+}
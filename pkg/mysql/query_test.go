@@ -0,0 +1,43 @@
+package mysql
+
+import "testing"
+
+func TestReadOnly(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected bool
+	}{
+		{"SELECT * FROM user WHERE id = ?", true},
+		{"  select\n1", true},
+		{"(SELECT 1) UNION (SELECT 2)", true},
+		{"WITH t AS (SELECT 1) SELECT * FROM t", true},
+		{"SHOW TABLES", true},
+		{"EXPLAIN SELECT 1", true},
+		{"UPDATE user SET email = ''", false},
+		{"DELETE FROM user", false},
+		{"INSERT INTO user VALUES (1)", false},
+		{"SELECTED", false},
+		{"", false},
+		{"WITH t AS (SELECT 1) DELETE FROM user", false},
+		{"WITH t AS (SELECT id FROM user) UPDATE user SET email = '' WHERE id IN (SELECT id FROM t)", false},
+		{"WITH RECURSIVE t (n) AS (SELECT 1 UNION ALL SELECT n + 1 FROM t WHERE n < 3), u AS (SELECT 2) SELECT * FROM t, u", true},
+		{"WITH t AS (SELECT 1) (SELECT * FROM t)", true},
+		{"SELECT * FROM user INTO OUTFILE '/tmp/user.csv'", false},
+		{"SELECT * INTO DUMPFILE '/tmp/user' FROM user", false},
+		{"SELECT id INTO @id FROM user", false},
+		{"SELECT * FROM user WHERE id = 1 FOR UPDATE", false},
+		{"SELECT * FROM user FOR SHARE", false},
+		{"SELECT * FROM user LOCK IN SHARE MODE", false},
+		{"SELECT 'INTO OUTFILE', `for` FROM user -- FOR UPDATE", true},
+		{"SELECT /* LOCK IN SHARE MODE */ 1", true},
+		{"SHOW GRANTS FOR CURRENT_USER", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			if got := readOnly(tt.query); got != tt.expected {
+				t.Errorf("readOnly(%q) = %v, expected %v", tt.query, got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package mysql
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/go-mysql-org/go-mysql/client"
+	"github.com/go-mysql-org/go-mysql/schema"
+)
+
+// TableSchema describes a monitored table as handlers see its rows.
+type TableSchema struct {
+	Database string
+	Table    string
+	Columns  []ColumnSchema
+}
+
+// ColumnSchema describes a column of a monitored table.
+type ColumnSchema struct {
+	Name     string
+	RawType  string
+	Nullable bool
+
+	// JSType is the TypeScript type of the values handlers receive for the
+	// column.
+	JSType string
+}
+
+// tableRegex returns the patterns matched against "database.table" to decide
+// which tables are monitored.
+func tableRegex(schema string, tables []string) []string {
+	patterns := make([]string, 0, len(tables))
+	for _, table := range tables {
+		patterns = append(patterns, schema+"\\."+table)
+	}
+
+	return patterns
+}
+
+// DescribeTables reads the column metadata of the tables a listener created
+// with opt monitors.
+func DescribeTables(opt *BinlogListenerOptions) ([]TableSchema, error) {
+	patterns, err := compileTableRegex(opt.Schema, opt.Tables)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig, err := newTLSConfig(opt.TLS, opt.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := client.Connect(fmt.Sprintf("%s:%d", opt.Host, opt.Port), opt.User, opt.Password, "", func(c *client.Conn) error {
+		if tlsConfig != nil {
+			c.SetTLSConfig(tlsConfig)
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("describing tables: %w", err)
+	}
+
+	defer conn.Close()
+
+	rr, err := conn.Execute(`SELECT TABLE_NAME, COLUMN_NAME, COLUMN_TYPE, IS_NULLABLE, COLLATION_NAME, EXTRA
+		FROM information_schema.COLUMNS
+		WHERE TABLE_SCHEMA = ?
+		ORDER BY TABLE_NAME, ORDINAL_POSITION`, opt.Schema)
+
+	if err != nil {
+		return nil, fmt.Errorf("describing tables: %w", err)
+	}
+
+	var tables []TableSchema
+	var current *schema.Table
+	var nullable []bool
+
+	flush := func() {
+		if current != nil {
+			tables = append(tables, newTableSchema(current, nullable))
+		}
+	}
+
+	for i := range rr.Values {
+		name, _ := rr.GetString(i, 0)
+
+		if !matchTable(patterns, opt.Schema+"."+name) {
+			continue
+		}
+
+		if current == nil || current.Name != name {
+			flush()
+			current = &schema.Table{Schema: opt.Schema, Name: name}
+			nullable = nil
+		}
+
+		column, _ := rr.GetString(i, 1)
+		columnType, _ := rr.GetString(i, 2)
+		isNullable, _ := rr.GetString(i, 3)
+		collation, _ := rr.GetString(i, 4)
+		extra, _ := rr.GetString(i, 5)
+
+		// classify columns the same way canal does when decoding rows
+		current.AddColumn(column, strings.ToLower(columnType), collation, extra)
+		nullable = append(nullable, isNullable == "YES")
+	}
+
+	flush()
+
+	if len(tables) == 0 {
+		return nil, fmt.Errorf("no tables in %s match %s", opt.Schema, strings.Join(opt.Tables, ", "))
+	}
+
+	return tables, nil
+}
+
+func compileTableRegex(schema string, tables []string) ([]*regexp.Regexp, error) {
+	patterns := make([]*regexp.Regexp, 0, len(tables))
+	for _, pattern := range tableRegex(schema, tables) {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid table %q: %w", pattern, err)
+		}
+		patterns = append(patterns, re)
+	}
+
+	return patterns, nil
+}
+
+// matchTable reports whether canal would replicate the table, patterns are
+// not anchored.
+func matchTable(patterns []*regexp.Regexp, key string) bool {
+	for _, re := range patterns {
+		if re.MatchString(key) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func newTableSchema(table *schema.Table, nullable []bool) TableSchema {
+	ts := TableSchema{Database: table.Schema, Table: table.Name}
+
+	for i, column := range table.Columns {
+		ts.Columns = append(ts.Columns, ColumnSchema{
+			Name:     column.Name,
+			RawType:  column.RawType,
+			Nullable: nullable[i],
+			JSType:   jsType(column),
+		})
+	}
+
+	return ts
+}
+
+// jsType maps a column to the type of the values decoded from the binlog as
+// they are exposed to handlers. Integers and floats are numbers, enum and set
+// columns are their numeric index and bitmask, decimals and temporal types
+// are strings and BLOB, TEXT and spatial columns arrive as byte arrays.
+func jsType(column schema.TableColumn) string {
+	switch column.Type {
+	case schema.TYPE_NUMBER, schema.TYPE_MEDIUM_INT, schema.TYPE_FLOAT,
+		schema.TYPE_ENUM, schema.TYPE_SET, schema.TYPE_BIT:
+		return "number"
+	case schema.TYPE_POINT:
+		return "number[]"
+	}
+
+	rawType := column.RawType
+	for _, prefix := range []string{"tinyblob", "blob", "mediumblob", "longblob", "tinytext", "text", "mediumtext", "longtext", "geometry", "linestring", "polygon", "multi", "vector"} {
+		if strings.HasPrefix(rawType, prefix) {
+			return "number[]"
+		}
+	}
+
+	return "string"
+}
@@ -0,0 +1,70 @@
+package mysql
+
+import (
+	"testing"
+
+	"github.com/go-mysql-org/go-mysql/schema"
+)
+
+func TestJSType(t *testing.T) {
+	tests := []struct {
+		columnType string
+		expected   string
+	}{
+		{"int", "number"},
+		{"bigint unsigned", "number"},
+		{"mediumint", "number"},
+		{"year", "number"},
+		{"double", "number"},
+		{"enum('a','b')", "number"},
+		{"set('a','b')", "number"},
+		{"bit(8)", "number"},
+		{"decimal(10,2)", "string"},
+		{"varchar(255)", "string"},
+		{"char(36)", "string"},
+		{"varbinary(16)", "string"},
+		{"datetime(6)", "string"},
+		{"timestamp", "string"},
+		{"date", "string"},
+		{"time", "string"},
+		{"json", "string"},
+		{"text", "number[]"},
+		{"longblob", "number[]"},
+		{"point", "number[]"},
+		{"geometry", "number[]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.columnType, func(t *testing.T) {
+			table := &schema.Table{}
+			table.AddColumn("c", tt.columnType, "", "")
+
+			if got := jsType(table.Columns[0]); got != tt.expected {
+				t.Errorf("jsType(%q) = %q, expected %q", tt.columnType, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestMatchTable(t *testing.T) {
+	patterns, err := compileTableRegex("dbscript", []string{"user", "event_.*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		key      string
+		expected bool
+	}{
+		{"dbscript.user", true},
+		{"dbscript.event_2024", true},
+		{"other.user", false},
+		{"dbscript.account", false},
+	}
+
+	for _, tt := range tests {
+		if got := matchTable(patterns, tt.key); got != tt.expected {
+			t.Errorf("matchTable(%q) = %v, expected %v", tt.key, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package mysql
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/canal"
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+// serverIDCheckInterval is how often a running listener checks that no other
+// replica registered with its server ID.
+const serverIDCheckInterval = 30 * time.Second
+
+// ServerIDConflictError is returned when another replica is using the same
+// replication server ID. MySQL only allows one connection per server ID and
+// disconnects the older one, so both replicas would keep kicking each other
+// off the replication stream.
+type ServerIDConflictError struct {
+	ServerID uint32
+	Host     string
+}
+
+func (e *ServerIDConflictError) Error() string {
+	if e.Host == "" {
+		return fmt.Sprintf("replication server ID %d is already in use by another replica, configure a unique --server-id", e.ServerID)
+	}
+
+	return fmt.Sprintf("replication server ID %d is already in use by replica %q, configure a unique --server-id", e.ServerID, e.Host)
+}
+
+// defaultServerID derives a stable server ID from the hostname and source
+// name so restarts reuse the same ID while sources in one process and
+// processes on different hosts are unlikely to collide.
+func defaultServerID(name string) uint32 {
+	hostname, _ := os.Hostname()
+
+	h := fnv.New32a()
+	h.Write([]byte(hostname))
+	h.Write([]byte{0})
+	h.Write([]byte(name))
+
+	// stay clear of the low IDs conventionally used by real servers
+	return h.Sum32()%(1<<31) + 1001
+}
+
+// replicaHostname is the hostname the listener registers with, it is unique
+// per process so a replica using the same server ID can be told apart.
+func replicaHostname() string {
+	return fmt.Sprintf("%s%d", replicaHostPrefix(), os.Getpid())
+}
+
+// replicaHostPrefix is the part of replicaHostname shared by every process on
+// this host.
+func replicaHostPrefix() string {
+	hostname, _ := os.Hostname()
+
+	return fmt.Sprintf("dbscript-%s-", hostname)
+}
+
+// isConflict reports whether a replica registered as host with our server ID
+// is another replica. When starting, registrations of other processes on this
+// host are taken as left behind by a previous run: the primary keeps them
+// until its connection times out, and a process still using the ID is
+// disconnected by ours and stops on the conflict.
+func isConflict(host, self string, starting bool) bool {
+	if host == self {
+		return false
+	}
+
+	return !starting || !strings.HasPrefix(host, replicaHostPrefix())
+}
+
+// checkServerID looks for a registered replica other than ourself using
+// serverID. self is the hostname this listener registers as, starting skips
+// stale registrations of this host as isConflict describes.
+func checkServerID(c *canal.Canal, serverID uint32, self string, starting bool) error {
+	rr, err := c.Execute("SHOW REPLICAS")
+
+	if err != nil {
+		// SHOW REPLICAS was added in MySQL 8.0.22
+		rr, err = c.Execute("SHOW SLAVE HOSTS")
+	}
+
+	if err != nil {
+		return fmt.Errorf("listing replicas: %w", err)
+	}
+
+	// SHOW REPLICAS names the column Server_Id, SHOW SLAVE HOSTS Server_id
+	idColumn, hostColumn := -1, -1
+	for name, column := range rr.FieldNames {
+		switch strings.ToLower(name) {
+		case "server_id":
+			idColumn = column
+		case "host":
+			hostColumn = column
+		}
+	}
+
+	if idColumn < 0 || hostColumn < 0 {
+		return fmt.Errorf("listing replicas: unexpected columns")
+	}
+
+	for row := 0; row < rr.RowNumber(); row++ {
+		id, err := rr.GetUint(row, idColumn)
+		if err != nil {
+			return fmt.Errorf("listing replicas: %w", err)
+		}
+
+		if uint32(id) != serverID {
+			continue
+		}
+
+		host, _ := rr.GetString(row, hostColumn)
+
+		if !isConflict(host, self, starting) {
+			continue
+		}
+
+		return &ServerIDConflictError{ServerID: serverID, Host: host}
+	}
+
+	return nil
+}
+
+// isServerIDConflict reports whether err is the error MySQL sends a replica
+// that was disconnected because another one connected with its server ID.
+func isServerIDConflict(err error) bool {
+	var myErr *mysql.MyError
+
+	if !errors.As(err, &myErr) {
+		return false
+	}
+
+	return myErr.Code == mysql.ER_MASTER_FATAL_ERROR_READING_BINLOG &&
+		strings.Contains(myErr.Message, "same server_uuid/server_id")
+}
@@ -0,0 +1,87 @@
+package mysql
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+func TestDefaultServerID(t *testing.T) {
+	if defaultServerID("shard1") != defaultServerID("shard1") {
+		t.Errorf("defaultServerID() should be stable for the same source")
+	}
+
+	if defaultServerID("shard1") == defaultServerID("shard2") {
+		t.Errorf("defaultServerID() should differ between sources")
+	}
+
+	if id := defaultServerID(""); id < 1001 {
+		t.Errorf("defaultServerID() = %d, expected >= 1001", id)
+	}
+}
+
+func TestIsServerIDConflict(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{
+			name: "duplicate server id",
+			err: fmt.Errorf("sync: %w", mysql.NewError(mysql.ER_MASTER_FATAL_ERROR_READING_BINLOG,
+				"A slave with the same server_uuid/server_id as this slave has connected to the master")),
+			expected: true,
+		},
+		{
+			name:     "other binlog error",
+			err:      mysql.NewError(mysql.ER_MASTER_FATAL_ERROR_READING_BINLOG, "Could not find first log file name in binary log index file"),
+			expected: false,
+		},
+		{
+			name:     "not a mysql error",
+			err:      errors.New("connection reset by peer"),
+			expected: false,
+		},
+		{
+			name:     "nil",
+			err:      nil,
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isServerIDConflict(tt.err); got != tt.expected {
+				t.Errorf("isServerIDConflict() = %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestIsConflict(t *testing.T) {
+	self := replicaHostname()
+	previous := replicaHostPrefix() + "1"
+
+	tests := []struct {
+		name     string
+		host     string
+		starting bool
+		expected bool
+	}{
+		{name: "ourself", host: self, starting: false, expected: false},
+		{name: "previous run when starting", host: previous, starting: true, expected: false},
+		{name: "process on this host when running", host: previous, starting: false, expected: true},
+		{name: "other host when starting", host: "dbscript-other-1", starting: true, expected: true},
+		{name: "other replica", host: "replica-2", starting: false, expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isConflict(tt.host, self, tt.starting); got != tt.expected {
+				t.Errorf("isConflict(%q) = %v, expected %v", tt.host, got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package mysql
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// TLSOptions configures TLS for both the replication and metadata
+// connections.
+type TLSOptions struct {
+	// Enabled turns on TLS using the system roots when no CAFile is given.
+	Enabled bool
+
+	// CAFile is a PEM bundle used to verify the server certificate.
+	CAFile string
+
+	// CertFile and KeyFile are a PEM client certificate and key for servers
+	// requiring client authentication.
+	CertFile string
+	KeyFile  string
+
+	// ServerName overrides the name the server certificate is verified
+	// against, defaults to the connection host.
+	ServerName string
+
+	// InsecureSkipVerify disables server certificate verification, only use
+	// it for development.
+	InsecureSkipVerify bool
+}
+
+func (o TLSOptions) enabled() bool {
+	return o.Enabled || o.CAFile != "" || o.CertFile != "" || o.InsecureSkipVerify
+}
+
+// newTLSConfig builds a tls.Config from the options, nil when TLS is disabled.
+func newTLSConfig(opt TLSOptions, host string) (*tls.Config, error) {
+	if !opt.enabled() {
+		return nil, nil
+	}
+
+	cfg := &tls.Config{
+		ServerName:         opt.ServerName,
+		InsecureSkipVerify: opt.InsecureSkipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+
+	if cfg.ServerName == "" {
+		cfg.ServerName = host
+	}
+
+	if opt.CAFile != "" {
+		pem, err := os.ReadFile(opt.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading TLS CA file: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in TLS CA file %s", opt.CAFile)
+		}
+
+		cfg.RootCAs = pool
+	}
+
+	if opt.CertFile != "" || opt.KeyFile != "" {
+		if opt.CertFile == "" || opt.KeyFile == "" {
+			return nil, fmt.Errorf("TLS client certificate and key must be set together")
+		}
+
+		cert, err := tls.LoadX509KeyPair(opt.CertFile, opt.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading TLS client certificate: %w", err)
+		}
+
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
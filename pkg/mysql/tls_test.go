@@ -0,0 +1,105 @@
+package mysql
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeTestCert(t *testing.T) (certFile, keyFile string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "dbscript test"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return certFile, keyFile
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	certFile, keyFile := writeTestCert(t)
+
+	t.Run("disabled", func(t *testing.T) {
+		cfg, err := newTLSConfig(TLSOptions{}, "db")
+		if err != nil || cfg != nil {
+			t.Errorf("newTLSConfig() = %v, %v, expected nil, nil", cfg, err)
+		}
+	})
+
+	t.Run("ca and client certificate", func(t *testing.T) {
+		cfg, err := newTLSConfig(TLSOptions{CAFile: certFile, CertFile: certFile, KeyFile: keyFile}, "db")
+		if err != nil {
+			t.Fatalf("newTLSConfig() error = %v", err)
+		}
+		if cfg.RootCAs == nil {
+			t.Errorf("RootCAs should be set")
+		}
+		if len(cfg.Certificates) != 1 {
+			t.Errorf("len(Certificates) = %d, expected 1", len(cfg.Certificates))
+		}
+		if cfg.ServerName != "db" {
+			t.Errorf("ServerName = %q, expected host %q", cfg.ServerName, "db")
+		}
+	})
+
+	t.Run("server name override", func(t *testing.T) {
+		cfg, err := newTLSConfig(TLSOptions{Enabled: true, ServerName: "mysql.internal"}, "10.0.0.1")
+		if err != nil {
+			t.Fatalf("newTLSConfig() error = %v", err)
+		}
+		if cfg.ServerName != "mysql.internal" {
+			t.Errorf("ServerName = %q, expected %q", cfg.ServerName, "mysql.internal")
+		}
+	})
+
+	t.Run("certificate without key", func(t *testing.T) {
+		if _, err := newTLSConfig(TLSOptions{CertFile: certFile}, "db"); err == nil {
+			t.Errorf("newTLSConfig() expected error")
+		}
+	})
+
+	t.Run("invalid ca file", func(t *testing.T) {
+		if _, err := newTLSConfig(TLSOptions{CAFile: keyFile}, "db"); err == nil {
+			t.Errorf("newTLSConfig() expected error")
+		}
+	})
+}
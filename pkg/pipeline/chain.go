@@ -0,0 +1,142 @@
+package pipeline
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/JayJamieson/dbscript/pkg/event"
+)
+
+// ErrorPolicy is what a Chain does with an event a stage errors on.
+type ErrorPolicy string
+
+const (
+	// ErrorRetry fails the whole chain so the event is retried, the retry
+	// continues at the stage that errored with the event it received.
+	ErrorRetry ErrorPolicy = "retry"
+	// ErrorDrop drops the event.
+	ErrorDrop ErrorPolicy = "drop"
+	// ErrorSkip passes the event the stage received on to the next stage.
+	ErrorSkip ErrorPolicy = "skip"
+)
+
+// Stage is a named handler in a Chain, OnError defaults to ErrorRetry.
+type Stage struct {
+	Name    string
+	Handler Handler
+	OnError ErrorPolicy
+}
+
+// Chain runs an event through its stages in order. The event a stage
+// forwards with ok is the input of the next one, a drop stops the chain.
+// Events emitted by the stages that ran are delivered with the outcome, and
+// the sinks the last stage routing the event picked are kept.
+//
+// Stages before one that errors are not run again when the event is retried,
+// their state writes are committed already and would be applied twice.
+type Chain struct {
+	stages []Stage
+
+	// mu guards resume
+	mu sync.Mutex
+
+	// resume is where the retry of the last event a stage errored on starts,
+	// the pipeline retries an event before executing the next one
+	resume *resumePoint
+}
+
+// resumePoint is the progress of an event up to the stage that errored.
+type resumePoint struct {
+	id      string
+	stage   int
+	event   event.Event
+	sinks   []string
+	emitted []event.Event
+}
+
+// NewChain returns a handler running stages in order.
+func NewChain(stages ...Stage) *Chain {
+	return &Chain{stages: stages}
+}
+
+// Execute runs the stages on e and returns the outcome of the chain.
+func (c *Chain) Execute(e event.Event) (event.Outcome, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	start, current := 0, e
+
+	var sinks []string
+	var emitted []event.Event
+
+	id, _ := e.Metadata[event.MetadataID].(string)
+
+	if r := c.resume; r != nil && r.id == id && e.RetryCount() > 0 {
+		start, current = r.stage, r.event.WithRetryCount(e.RetryCount())
+		sinks, emitted = r.sinks, r.emitted
+	}
+
+	c.resume = nil
+
+	for i := start; i < len(c.stages); i++ {
+		stage := c.stages[i]
+		outcome, err := stage.Handler.Execute(current)
+
+		if err != nil {
+			outcome = event.Outcome{Action: event.Error, Event: current, Err: err}
+		}
+
+		switch outcome.Action {
+		case event.Error:
+			err := fmt.Errorf("stage %s: %w", stage.Name, outcome.Err)
+
+			switch stage.OnError {
+			case ErrorSkip:
+				continue
+			case ErrorDrop:
+				return event.Outcome{Action: event.Drop, Event: current, Reason: err.Error(), Emitted: emitted}, nil
+			}
+
+			c.resume = &resumePoint{id: id, stage: i, event: current, sinks: sinks, emitted: emitted}
+
+			return event.Outcome{Action: event.Error, Event: e, Err: err}, nil
+		case event.Drop:
+			outcome.Emitted = append(emitted, outcome.Emitted...)
+			return outcome, nil
+		}
+
+		emitted = append(emitted, outcome.Emitted...)
+		current = outcome.Event
+
+		if len(current.Sinks) > 0 {
+			sinks = current.Sinks
+		}
+	}
+
+	current.Sinks = sinks
+
+	return event.Outcome{Action: event.Ok, Event: current, Emitted: emitted}, nil
+}
+
+// TableRouter hands events to the handler of their "database.table", events
+// of other tables go to Default.
+type TableRouter struct {
+	Tables  map[string]Handler
+	Default Handler
+}
+
+// Execute runs the handler of the event's table.
+func (r *TableRouter) Execute(e event.Event) (event.Outcome, error) {
+	table := event.TableOf(e)
+
+	handler, ok := r.Tables[table]
+	if !ok {
+		handler = r.Default
+	}
+
+	if handler == nil {
+		return event.Outcome{}, fmt.Errorf("no handler for table %s", table)
+	}
+
+	return handler.Execute(e)
+}
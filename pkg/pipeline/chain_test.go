@@ -0,0 +1,242 @@
+package pipeline
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/JayJamieson/dbscript/pkg/event"
+	"github.com/JayJamieson/dbscript/pkg/mysql"
+)
+
+// markStage appends its name to the "stages" metadata and returns action.
+func markStage(name string, action event.Action) handlerFunc {
+	return func(e event.Event) (event.Outcome, error) {
+		metadata := make(map[string]any, len(e.Metadata)+1)
+		for k, v := range e.Metadata {
+			metadata[k] = v
+		}
+
+		stages, _ := metadata["stages"].([]string)
+		metadata["stages"] = append(append([]string(nil), stages...), name)
+
+		e.Metadata = metadata
+
+		switch action {
+		case event.Drop:
+			return event.Outcome{Action: event.Drop, Event: e, Reason: name}, nil
+		case event.Error:
+			return event.Outcome{}, errors.New(name + " failed")
+		}
+
+		emitted := event.Event{Metadata: map[string]any{"from": name}}
+
+		return event.Outcome{Action: event.Ok, Event: e, Emitted: []event.Event{emitted}}, nil
+	}
+}
+
+func TestChain(t *testing.T) {
+	tests := []struct {
+		name     string
+		stages   []Stage
+		action   event.Action
+		ran      []string
+		emitted  int
+		original bool
+	}{
+		{
+			name: "ok feeds the next stage",
+			stages: []Stage{
+				{Name: "filter", Handler: markStage("filter", event.Ok)},
+				{Name: "enrich", Handler: markStage("enrich", event.Ok)},
+			},
+			action:  event.Ok,
+			ran:     []string{"filter", "enrich"},
+			emitted: 2,
+		},
+		{
+			name: "drop stops the chain",
+			stages: []Stage{
+				{Name: "filter", Handler: markStage("filter", event.Ok)},
+				{Name: "mask", Handler: markStage("mask", event.Drop)},
+				{Name: "enrich", Handler: markStage("enrich", event.Ok)},
+			},
+			action:  event.Drop,
+			ran:     []string{"filter", "mask"},
+			emitted: 1,
+		},
+		{
+			name: "retry",
+			stages: []Stage{
+				{Name: "filter", Handler: markStage("filter", event.Ok)},
+				{Name: "enrich", Handler: markStage("enrich", event.Error)},
+			},
+			action:   event.Error,
+			original: true,
+		},
+		{
+			name: "drop on error",
+			stages: []Stage{
+				{Name: "filter", Handler: markStage("filter", event.Ok)},
+				{Name: "enrich", Handler: markStage("enrich", event.Error), OnError: ErrorDrop},
+				{Name: "route", Handler: markStage("route", event.Ok)},
+			},
+			action:  event.Drop,
+			ran:     []string{"filter"},
+			emitted: 1,
+		},
+		{
+			name: "skip on error",
+			stages: []Stage{
+				{Name: "enrich", Handler: markStage("enrich", event.Error), OnError: ErrorSkip},
+				{Name: "route", Handler: markStage("route", event.Ok)},
+			},
+			action:  event.Ok,
+			ran:     []string{"route"},
+			emitted: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := event.New(createTestChanges()[0])
+
+			outcome, err := NewChain(tt.stages...).Execute(e)
+			if err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+
+			if outcome.Action != tt.action {
+				t.Errorf("Action = %v, expected %v", outcome.Action, tt.action)
+			}
+
+			if tt.original {
+				if _, ok := outcome.Event.Metadata["stages"]; ok {
+					t.Errorf("retried event should be the original event, got %v", outcome.Event.Metadata)
+				}
+				if outcome.Err == nil {
+					t.Errorf("Err should be set")
+				}
+				return
+			}
+
+			if ran, _ := outcome.Event.Metadata["stages"].([]string); !reflect.DeepEqual(ran, tt.ran) {
+				t.Errorf("stages = %v, expected %v", ran, tt.ran)
+			}
+
+			if len(outcome.Emitted) != tt.emitted {
+				t.Errorf("len(Emitted) = %d, expected %d", len(outcome.Emitted), tt.emitted)
+			}
+		})
+	}
+}
+
+func TestChainKeepsSinks(t *testing.T) {
+	route := handlerFunc(func(e event.Event) (event.Outcome, error) {
+		e.Sinks = []string{"users"}
+		return event.Outcome{Action: event.Ok, Event: e}, nil
+	})
+
+	outcome, err := NewChain(
+		Stage{Name: "route", Handler: route},
+		Stage{Name: "mask", Handler: markStage("mask", event.Ok)},
+	).Execute(event.New(createTestChanges()[0]))
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(outcome.Event.Sinks, []string{"users"}) {
+		t.Errorf("Sinks = %v, expected [users]", outcome.Event.Sinks)
+	}
+}
+
+func TestTableRouter(t *testing.T) {
+	router := &TableRouter{
+		Tables: map[string]Handler{"dbscript.user": markStage("user", event.Ok)},
+	}
+
+	outcome, err := router.Execute(event.New(createTestChanges()[0]))
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	if ran, _ := outcome.Event.Metadata["stages"].([]string); !reflect.DeepEqual(ran, []string{"user"}) {
+		t.Errorf("stages = %v, expected [user]", ran)
+	}
+
+	orders := event.New(mysql.RowChangeEvent{Database: "dbscript", Table: "orders", Type: "INSERT"})
+
+	if _, err := router.Execute(orders); err == nil {
+		t.Errorf("Execute() should fail without a default handler")
+	}
+
+	router.Default = markStage("default", event.Ok)
+
+	outcome, err = router.Execute(orders)
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	if ran, _ := outcome.Event.Metadata["stages"].([]string); !reflect.DeepEqual(ran, []string{"default"}) {
+		t.Errorf("stages = %v, expected [default]", ran)
+	}
+}
+
+func TestChainRetry(t *testing.T) {
+	filtered := 0
+	filter := handlerFunc(func(e event.Event) (event.Outcome, error) {
+		filtered++
+		return markStage("filter", event.Ok)(e)
+	})
+
+	enrich := handlerFunc(func(e event.Event) (event.Outcome, error) {
+		if e.RetryCount() == 0 {
+			return markStage("enrich", event.Error)(e)
+		}
+		return markStage("enrich", event.Ok)(e)
+	})
+
+	chain := NewChain(Stage{Name: "filter", Handler: filter}, Stage{Name: "enrich", Handler: enrich})
+
+	e := event.New(createTestChanges()[0])
+
+	outcome, err := chain.Execute(e)
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	if outcome.Action != event.Error {
+		t.Fatalf("Action = %v, expected %v", outcome.Action, event.Error)
+	}
+
+	// the retry continues at enrich with the event filter forwarded
+	outcome, err = chain.Execute(outcome.Event.WithRetryCount(1))
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	if filtered != 1 {
+		t.Errorf("filter ran %d times, expected 1", filtered)
+	}
+
+	if ran, _ := outcome.Event.Metadata["stages"].([]string); !reflect.DeepEqual(ran, []string{"filter", "enrich"}) {
+		t.Errorf("stages = %v, expected [filter enrich]", ran)
+	}
+
+	if outcome.Event.RetryCount() != 1 {
+		t.Errorf("RetryCount() = %d, expected 1", outcome.Event.RetryCount())
+	}
+
+	if len(outcome.Emitted) != 2 {
+		t.Errorf("len(Emitted) = %d, expected 2", len(outcome.Emitted))
+	}
+
+	// other events start at the first stage
+	if _, err := chain.Execute(event.New(createTestChanges()[1]).WithRetryCount(1)); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	if filtered != 2 {
+		t.Errorf("filter ran %d times, expected 2", filtered)
+	}
+}
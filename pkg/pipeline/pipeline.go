@@ -0,0 +1,493 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/JayJamieson/dbscript/pkg/event"
+	"github.com/JayJamieson/dbscript/pkg/mysql"
+)
+
+const (
+	// DefaultBatchWindow is how long events are collected for a batch.
+	DefaultBatchWindow = 100 * time.Millisecond
+
+	// retryBackoff is the delay before the first retry of an event, it
+	// doubles with every retry up to maxRetryBackoff.
+	retryBackoff    = 100 * time.Millisecond
+	maxRetryBackoff = 5 * time.Second
+)
+
+// Handler processes a single event and decides what happens to it.
+type Handler interface {
+	Execute(e event.Event) (event.Outcome, error)
+}
+
+// BatchHandler processes several events in one invocation and decides what
+// happens to each of them, outcomes are in the order of events.
+type BatchHandler interface {
+	Handler
+	ExecuteBatch(events []event.Event) ([]event.Outcome, error)
+}
+
+// Sink is the final destination of processed events.
+type Sink interface {
+	Write(events []event.Event) error
+}
+
+type Options struct {
+	Handler Handler
+	Logger  *slog.Logger
+
+	// Sink receives the events not routed to a named sink.
+	Sink Sink
+
+	// Sinks are the named sinks handlers route events to.
+	Sinks map[string]Sink
+
+	// DeadLetter receives the events still erroring after MaxRetries with
+	// the error in metadata, they are dropped when it is nil.
+	DeadLetter Sink
+
+	// MaxRetries is how many times an errored event is retried, zero or
+	// negative disables retries.
+	MaxRetries int
+
+	// BatchSize is how many events a BatchHandler receives at most, events
+	// are collected for up to BatchWindow, DefaultBatchWindow when zero.
+	// Batching is off below 2 and for handlers that are not a BatchHandler.
+	BatchSize   int
+	BatchWindow time.Duration
+}
+
+// Pipeline fans events from any number of listeners into a single shared
+// handler and sink. Events of one listener are delivered in binlog order and
+// its checkpoint only advances past events that have been written, together
+// with every event their invocations emitted.
+type Pipeline struct {
+	handler    Handler
+	sink       Sink
+	sinks      map[string]Sink
+	deadLetter Sink
+	logger     *slog.Logger
+	maxRetries int
+
+	// retryBackoff is the delay before the first retry
+	retryBackoff time.Duration
+
+	// batchHandler is set when batching is on
+	batchHandler BatchHandler
+	batchSize    int
+	batchWindow  time.Duration
+
+	// mu serialises the handler and sink across listeners
+	mu sync.Mutex
+}
+
+func New(opt Options) *Pipeline {
+	p := &Pipeline{
+		handler:     opt.Handler,
+		sink:        opt.Sink,
+		sinks:       opt.Sinks,
+		deadLetter:  opt.DeadLetter,
+		logger:      opt.Logger,
+		maxRetries:  max(opt.MaxRetries, 0),
+		batchSize:   opt.BatchSize,
+		batchWindow: opt.BatchWindow,
+
+		retryBackoff: retryBackoff,
+	}
+
+	if batchHandler, ok := opt.Handler.(BatchHandler); ok && opt.BatchSize > 1 {
+		p.batchHandler = batchHandler
+	}
+
+	if p.batchWindow <= 0 {
+		p.batchWindow = DefaultBatchWindow
+	}
+
+	return p
+}
+
+// Run consumes the listener streams until ctx is cancelled or writing fails.
+func (p *Pipeline) Run(ctx context.Context, listener *mysql.BinlogListener) error {
+	return run(ctx, p, listener.GetEventStream(), listener.GetSavepointStream(), listener.Commit)
+}
+
+// savepoint is a position a listener checkpoints once the row batches it sent
+// before it are written.
+type savepoint interface {
+	RowBatches() uint64
+}
+
+// run writes events and commits savepoints in the order the listener sent
+// them.
+func run[S savepoint](ctx context.Context, p *Pipeline, events <-chan []mysql.RowChangeEvent, savepoints <-chan S, commit func(S) error) error {
+	// rowBatches counts the row batches written, savepoints carry how many
+	// were sent before them
+	var rowBatches uint64
+
+	// pending are the changes collected for a batch handler until the window
+	// closes, pendingBatches the row batches they came from
+	var pending []mysql.RowChangeEvent
+	var pendingBatches uint64
+	var window <-chan time.Time
+
+	flush := func() error {
+		if len(pending) == 0 {
+			return nil
+		}
+
+		err := p.write(ctx, pending)
+		rowBatches += pendingBatches
+		pending, pendingBatches, window = nil, 0, nil
+
+		return err
+	}
+
+	receive := func(batch []mysql.RowChangeEvent) error {
+		if p.batchHandler == nil || isHeartbeat(batch) {
+			// heartbeats follow the changes before them
+			if err := flush(); err != nil {
+				return err
+			}
+			return p.process(ctx, batch, &rowBatches)
+		}
+
+		pending = append(pending, batch...)
+		pendingBatches++
+
+		if len(pending) >= p.batchSize {
+			return flush()
+		}
+
+		if window == nil {
+			window = time.After(p.batchWindow)
+		}
+
+		return nil
+	}
+
+	// checkpoint writes exactly the row batches sent before sp and commits
+	// it, so the checkpoint never gets ahead of the sink
+	checkpoint := func(sp S) error {
+		for rowBatches+pendingBatches < sp.RowBatches() {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case batch := <-events:
+				if err := receive(batch); err != nil {
+					return err
+				}
+			}
+		}
+
+		if err := flush(); err != nil {
+			return err
+		}
+
+		return commit(sp)
+	}
+
+	// next receives a batch once the savepoints sent before it are
+	// committed. The listener queues a savepoint before the batches after
+	// it, so it is on the stream by the time such a batch is received, and
+	// a select picking the batch first would otherwise commit the batch's
+	// state with the older checkpoint.
+	next := func(batch []mysql.RowChangeEvent) error {
+		for {
+			select {
+			case sp := <-savepoints:
+				if rowBatches+pendingBatches < sp.RowBatches() {
+					// sent after the batch
+					if err := receive(batch); err != nil {
+						return err
+					}
+					return checkpoint(sp)
+				}
+
+				if err := checkpoint(sp); err != nil {
+					return err
+				}
+			default:
+				return receive(batch)
+			}
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case batch := <-events:
+			if err := next(batch); err != nil {
+				return err
+			}
+		case <-window:
+			if err := flush(); err != nil {
+				return err
+			}
+		case sp := <-savepoints:
+			if err := checkpoint(sp); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// process writes a batch and counts it when it holds rows.
+func (p *Pipeline) process(ctx context.Context, batch []mysql.RowChangeEvent, rowBatches *uint64) error {
+	if err := p.write(ctx, batch); err != nil {
+		return err
+	}
+
+	if !isHeartbeat(batch) {
+		*rowBatches++
+	}
+
+	return nil
+}
+
+// isHeartbeat reports whether the batch is a heartbeat, they are always sent
+// alone.
+func isHeartbeat(batch []mysql.RowChangeEvent) bool {
+	return len(batch) == 1 && batch[0].Type == mysql.HeartbeatEvent
+}
+
+// write handles changes and writes the resulting events, nothing is written
+// when ctx is done while an event waits to be retried.
+func (p *Pipeline) write(ctx context.Context, changes []mysql.RowChangeEvent) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	out := make([]event.Event, 0, len(changes))
+
+	var pending, failed []event.Event
+
+	handle := func() error {
+		handled, dead, err := p.handleAll(ctx, pending)
+		out = append(out, handled...)
+		failed = append(failed, dead...)
+		pending = nil
+		return err
+	}
+
+	for _, change := range changes {
+		e := event.New(change)
+
+		// heartbeats only carry a position for the sink
+		if change.Type == mysql.HeartbeatEvent {
+			if err := handle(); err != nil {
+				return err
+			}
+			out = append(out, e)
+			continue
+		}
+
+		pending = append(pending, e)
+	}
+
+	if err := handle(); err != nil {
+		return err
+	}
+
+	if err := p.deliver(out); err != nil {
+		return err
+	}
+
+	return p.deadLetters(failed)
+}
+
+// handleAll handles events in order, in batches of up to BatchSize when
+// batching is on. Errored events of a batch are retried one at a time. It
+// returns the events to deliver and the events whose retries are exhausted.
+func (p *Pipeline) handleAll(ctx context.Context, events []event.Event) (out []event.Event, failed []event.Event, err error) {
+	settle := func(outcome event.Outcome) error {
+		delivered, dead, err := p.settle(ctx, outcome)
+		out = append(out, delivered...)
+		if dead != nil {
+			failed = append(failed, *dead)
+		}
+		return err
+	}
+
+	if p.batchHandler == nil {
+		for _, e := range events {
+			if err := settle(p.execute(e)); err != nil {
+				return nil, nil, err
+			}
+		}
+		return out, failed, nil
+	}
+
+	for batch := range slices.Chunk(events, p.batchSize) {
+		outcomes, err := p.batchHandler.ExecuteBatch(batch)
+
+		if err == nil && len(outcomes) != len(batch) {
+			err = fmt.Errorf("handler returned %d outcomes for %d events", len(outcomes), len(batch))
+		}
+
+		for i, e := range batch {
+			// a failed invocation fails every event of the batch
+			outcome := event.Outcome{Action: event.Error, Event: e, Err: err}
+			if err == nil {
+				outcome = outcomes[i]
+			}
+
+			if err := settle(outcome); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	return out, failed, nil
+}
+
+// deadLetters writes the events whose retries are exhausted to the dead
+// letter sink, before the checkpoint advances past them.
+func (p *Pipeline) deadLetters(events []event.Event) error {
+	if len(events) == 0 || p.deadLetter == nil {
+		return nil
+	}
+
+	if err := p.deadLetter.Write(events); err != nil {
+		return fmt.Errorf("writing dead letters: %w", err)
+	}
+
+	return nil
+}
+
+// deliver writes events to their sinks, each sink receives its events in
+// order in a single write.
+func (p *Pipeline) deliver(events []event.Event) error {
+	var names []string
+	batches := make(map[string][]event.Event)
+
+	for _, e := range events {
+		sinks := e.Sinks
+		if len(sinks) == 0 {
+			// the default sink
+			sinks = []string{""}
+		}
+
+		for _, name := range sinks {
+			if _, ok := batches[name]; !ok {
+				names = append(names, name)
+			}
+			batches[name] = append(batches[name], e)
+		}
+	}
+
+	for _, name := range names {
+		sink := p.sink
+		if name != "" {
+			sink = p.sinks[name]
+		}
+
+		if sink == nil {
+			return fmt.Errorf("writing events: unknown sink %q", name)
+		}
+
+		if err := sink.Write(batches[name]); err != nil {
+			if name == "" {
+				return fmt.Errorf("writing events: %w", err)
+			}
+			return fmt.Errorf("writing events to %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// execute runs the handler, uncaught exceptions and timeouts behave like
+// dbscript.ctx.error.
+func (p *Pipeline) execute(e event.Event) event.Outcome {
+	outcome, err := p.handler.Execute(e)
+	if err != nil {
+		return event.Outcome{Action: event.Error, Event: e, Err: err}
+	}
+
+	return outcome
+}
+
+// settle returns the events to deliver for an outcome, retrying errored
+// events: the forwarded event followed by the events the invocation emitted.
+// Emitted events of errored attempts are discarded. An event still erroring
+// after the last retry is returned as dead when there is a dead letter sink
+// and dropped otherwise. Retries back off, and give up with an error when ctx
+// is done.
+func (p *Pipeline) settle(ctx context.Context, outcome event.Outcome) (delivered []event.Event, dead *event.Event, err error) {
+	for {
+		switch outcome.Action {
+		case event.Ok:
+			return append([]event.Event{outcome.Event}, outcome.Emitted...), nil, nil
+		case event.Drop:
+			p.logger.Info("Event dropped",
+				"id", outcome.Event.Metadata[event.MetadataID],
+				"reason", outcome.Reason,
+			)
+			return outcome.Emitted, nil, nil
+		}
+
+		retry := outcome.Event.RetryCount() + 1
+
+		if retry > p.maxRetries {
+			msg := "Event failed, dropping"
+			if p.deadLetter != nil {
+				msg = "Event failed, dead lettering"
+			}
+
+			p.logger.Error(msg,
+				"id", outcome.Event.Metadata[event.MetadataID],
+				"retries", outcome.Event.RetryCount(),
+				"error", outcome.Err,
+				"event", outcome.Event,
+			)
+
+			if p.deadLetter == nil {
+				return nil, nil, nil
+			}
+
+			failed := outcome.Event
+			if outcome.Err != nil {
+				failed = failed.WithError(outcome.Err)
+			}
+
+			return nil, &failed, nil
+		}
+
+		p.logger.Warn("Event errored, retrying",
+			"id", outcome.Event.Metadata[event.MetadataID],
+			"retryCount", retry,
+			"error", outcome.Err,
+		)
+
+		if err := p.backoff(ctx, retry); err != nil {
+			return nil, nil, err
+		}
+
+		outcome = p.execute(outcome.Event.WithRetryCount(retry))
+	}
+}
+
+// backoff waits before the retry, the delay doubles with every retry.
+func (p *Pipeline) backoff(ctx context.Context, retry int) error {
+	delay := p.retryBackoff
+	for i := 1; i < retry && delay < maxRetryBackoff; i++ {
+		delay *= 2
+	}
+
+	timer := time.NewTimer(min(delay, maxRetryBackoff))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("retrying event: %w", ctx.Err())
+	case <-timer.C:
+		return nil
+	}
+}
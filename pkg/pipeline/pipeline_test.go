@@ -0,0 +1,448 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/JayJamieson/dbscript/pkg/event"
+	"github.com/JayJamieson/dbscript/pkg/mysql"
+)
+
+type handlerFunc func(e event.Event) (event.Outcome, error)
+
+func (f handlerFunc) Execute(e event.Event) (event.Outcome, error) {
+	return f(e)
+}
+
+type memorySink struct {
+	events []event.Event
+}
+
+func (s *memorySink) Write(events []event.Event) error {
+	s.events = append(s.events, events...)
+	return nil
+}
+
+func createTestChanges() []mysql.RowChangeEvent {
+	return []mysql.RowChangeEvent{
+		{Source: "default", Database: "dbscript", Table: "user", Type: "INSERT", After: map[string]any{"id": 1}},
+		{Source: "default", Database: "dbscript", Table: "user", Type: "INSERT", After: map[string]any{"id": 2}},
+	}
+}
+
+func newTestPipeline(handler handlerFunc, maxRetries int) (*Pipeline, *memorySink) {
+	sink := &memorySink{}
+
+	p := New(Options{
+		Handler:    handler,
+		Sink:       sink,
+		Logger:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+		MaxRetries: maxRetries,
+	})
+	p.retryBackoff = 0
+
+	return p, sink
+}
+
+func TestPipelineOutcomes(t *testing.T) {
+	p, sink := newTestPipeline(func(e event.Event) (event.Outcome, error) {
+		after := e.Payload.(map[string]any)["after"].(map[string]any)
+		if after["id"] == 2 {
+			return event.Outcome{Action: event.Drop, Event: e, Reason: "filtered"}, nil
+		}
+		return event.Outcome{Action: event.Ok, Event: e}, nil
+	}, 0)
+
+	if err := p.write(context.Background(), createTestChanges()); err != nil {
+		t.Fatalf("write() error = %v", err)
+	}
+
+	if len(sink.events) != 1 {
+		t.Fatalf("len(sink.events) = %d, expected 1", len(sink.events))
+	}
+}
+
+func TestPipelineRetries(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxRetries int
+		failures   int
+		delivered  int
+		attempts   int
+	}{
+		{name: "succeeds on retry", maxRetries: 3, failures: 2, delivered: 1, attempts: 3},
+		{name: "retries exhausted", maxRetries: 3, failures: 10, delivered: 0, attempts: 4},
+		{name: "no retries", maxRetries: 0, failures: 1, delivered: 0, attempts: 1},
+		{name: "retries disabled", maxRetries: -1, failures: 1, delivered: 0, attempts: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			retryCounts := []int{}
+
+			p, sink := newTestPipeline(func(e event.Event) (event.Outcome, error) {
+				attempts++
+				retryCounts = append(retryCounts, e.RetryCount())
+
+				if attempts <= tt.failures {
+					if attempts%2 == 0 {
+						return event.Outcome{}, errors.New("uncaught exception")
+					}
+					return event.Outcome{Action: event.Error, Event: e, Err: errors.New("failed")}, nil
+				}
+
+				return event.Outcome{Action: event.Ok, Event: e}, nil
+			}, tt.maxRetries)
+
+			if err := p.write(context.Background(), createTestChanges()[:1]); err != nil {
+				t.Fatalf("write() error = %v", err)
+			}
+
+			if attempts != tt.attempts {
+				t.Errorf("attempts = %d, expected %d", attempts, tt.attempts)
+			}
+
+			if len(sink.events) != tt.delivered {
+				t.Errorf("len(sink.events) = %d, expected %d", len(sink.events), tt.delivered)
+			}
+
+			for i, count := range retryCounts {
+				if count != i {
+					t.Errorf("attempt %d retryCount = %d, expected %d", i, count, i)
+				}
+			}
+		})
+	}
+}
+
+func TestPipelineRetryBackoff(t *testing.T) {
+	attempts := 0
+
+	p, sink := newTestPipeline(func(e event.Event) (event.Outcome, error) {
+		attempts++
+		return event.Outcome{Action: event.Error, Event: e, Err: errors.New("failed")}, nil
+	}, 3)
+	p.retryBackoff = time.Hour
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	// cancelling stops waiting for the retry and writes nothing
+	if err := p.write(ctx, createTestChanges()[:1]); !errors.Is(err, context.Canceled) {
+		t.Errorf("write() error = %v, expected %v", err, context.Canceled)
+	}
+
+	if attempts != 1 {
+		t.Errorf("attempts = %d, expected 1", attempts)
+	}
+
+	if len(sink.events) != 0 {
+		t.Errorf("len(sink.events) = %d, expected 0", len(sink.events))
+	}
+}
+
+func TestPipelineDeadLetter(t *testing.T) {
+	sink := &memorySink{}
+	deadLetter := &memorySink{}
+
+	p := New(Options{
+		Handler: handlerFunc(func(e event.Event) (event.Outcome, error) {
+			if e.Payload.(map[string]any)["after"].(map[string]any)["id"] == 2 {
+				return event.Outcome{Action: event.Error, Event: e, Err: errors.New("failed")}, nil
+			}
+			return event.Outcome{Action: event.Ok, Event: e}, nil
+		}),
+		Sink:       sink,
+		DeadLetter: deadLetter,
+		Logger:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+		MaxRetries: 1,
+	})
+	p.retryBackoff = 0
+
+	if err := p.write(context.Background(), createTestChanges()); err != nil {
+		t.Fatalf("write() error = %v", err)
+	}
+
+	if len(sink.events) != 1 {
+		t.Errorf("len(sink.events) = %d, expected 1", len(sink.events))
+	}
+
+	if len(deadLetter.events) != 1 {
+		t.Fatalf("len(deadLetter.events) = %d, expected 1", len(deadLetter.events))
+	}
+
+	failed := deadLetter.events[0]
+
+	if failed.Metadata[event.MetadataError] != "failed" {
+		t.Errorf("metadata error = %v, expected failed", failed.Metadata[event.MetadataError])
+	}
+
+	if failed.RetryCount() != 1 {
+		t.Errorf("RetryCount() = %d, expected 1", failed.RetryCount())
+	}
+}
+
+func TestPipelineHeartbeatSkipsHandler(t *testing.T) {
+	p, sink := newTestPipeline(func(e event.Event) (event.Outcome, error) {
+		t.Errorf("handler should not be called for heartbeats")
+		return event.Outcome{Action: event.Ok, Event: e}, nil
+	}, 0)
+
+	if err := p.write(context.Background(), []mysql.RowChangeEvent{{Source: "default", Type: mysql.HeartbeatEvent}}); err != nil {
+		t.Fatalf("write() error = %v", err)
+	}
+
+	if len(sink.events) != 1 {
+		t.Errorf("len(sink.events) = %d, expected 1", len(sink.events))
+	}
+}
+
+func TestPipelineEmitted(t *testing.T) {
+	derived := func(n int) event.Event {
+		return event.Event{Metadata: map[string]any{}, Payload: n}
+	}
+
+	tests := []struct {
+		name      string
+		action    event.Action
+		delivered []any
+	}{
+		{name: "ok", action: event.Ok, delivered: []any{"original", 1, 2}},
+		{name: "drop", action: event.Drop, delivered: []any{1, 2}},
+		{name: "error", action: event.Error, delivered: []any{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, sink := newTestPipeline(func(e event.Event) (event.Outcome, error) {
+				e.Payload = "original"
+				return event.Outcome{Action: tt.action, Event: e, Emitted: []event.Event{derived(1), derived(2)}}, nil
+			}, -1)
+
+			if err := p.write(context.Background(), createTestChanges()[:1]); err != nil {
+				t.Fatalf("write() error = %v", err)
+			}
+
+			if len(sink.events) != len(tt.delivered) {
+				t.Fatalf("len(sink.events) = %d, expected %d", len(sink.events), len(tt.delivered))
+			}
+
+			for i, payload := range tt.delivered {
+				if sink.events[i].Payload != payload {
+					t.Errorf("sink.events[%d].Payload = %v, expected %v", i, sink.events[i].Payload, payload)
+				}
+			}
+		})
+	}
+}
+
+func TestPipelineSinks(t *testing.T) {
+	sinks := map[string]*memorySink{"users": {}, "audit": {}}
+
+	defaultSink := &memorySink{}
+
+	p := New(Options{
+		Handler: handlerFunc(func(e event.Event) (event.Outcome, error) {
+			after := e.Payload.(map[string]any)["after"].(map[string]any)
+			if after["id"] == 1 {
+				e.Sinks = []string{"users", "audit"}
+			}
+			return event.Outcome{Action: event.Ok, Event: e}, nil
+		}),
+		Sink:   defaultSink,
+		Sinks:  map[string]Sink{"users": sinks["users"], "audit": sinks["audit"]},
+		Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+
+	if err := p.write(context.Background(), createTestChanges()); err != nil {
+		t.Fatalf("write() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		sink     *memorySink
+		expected int
+	}{
+		{"users", sinks["users"], 1},
+		{"audit", sinks["audit"], 1},
+		{"default", defaultSink, 1},
+	}
+
+	for _, tt := range tests {
+		if len(tt.sink.events) != tt.expected {
+			t.Errorf("len(%s.events) = %d, expected %d", tt.name, len(tt.sink.events), tt.expected)
+		}
+	}
+
+	p.handler = handlerFunc(func(e event.Event) (event.Outcome, error) {
+		e.Sinks = []string{"missing"}
+		return event.Outcome{Action: event.Ok, Event: e}, nil
+	})
+
+	if err := p.write(context.Background(), createTestChanges()[:1]); err == nil {
+		t.Errorf("write() expected error for an unknown sink")
+	}
+}
+
+type batchHandlerFunc func(events []event.Event) ([]event.Outcome, error)
+
+func (f batchHandlerFunc) Execute(e event.Event) (event.Outcome, error) {
+	outcomes, err := f([]event.Event{e})
+	if err != nil {
+		return event.Outcome{}, err
+	}
+	return outcomes[0], nil
+}
+
+func (f batchHandlerFunc) ExecuteBatch(events []event.Event) ([]event.Outcome, error) {
+	return f(events)
+}
+
+func TestPipelineBatches(t *testing.T) {
+	var sizes []int
+
+	handler := batchHandlerFunc(func(events []event.Event) ([]event.Outcome, error) {
+		sizes = append(sizes, len(events))
+
+		outcomes := make([]event.Outcome, len(events))
+		for i, e := range events {
+			switch e.Payload.(map[string]any)["after"].(map[string]any)["id"] {
+			case 2:
+				outcomes[i] = event.Outcome{Action: event.Drop, Event: e, Reason: "filtered"}
+			case 3:
+				if e.RetryCount() == 0 {
+					outcomes[i] = event.Outcome{Action: event.Error, Event: e, Err: errors.New("boom")}
+					continue
+				}
+				fallthrough
+			default:
+				outcomes[i] = event.Outcome{Action: event.Ok, Event: e}
+			}
+		}
+
+		return outcomes, nil
+	})
+
+	sink := &memorySink{}
+	p := New(Options{
+		Handler:    handler,
+		Sink:       sink,
+		Logger:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+		BatchSize:  2,
+		MaxRetries: 1,
+	})
+	p.retryBackoff = 0
+
+	changes := append(createTestChanges(),
+		mysql.RowChangeEvent{Source: "default", Database: "dbscript", Table: "user", Type: "INSERT", After: map[string]any{"id": 3}},
+		mysql.RowChangeEvent{Source: "default", Type: mysql.HeartbeatEvent},
+		mysql.RowChangeEvent{Source: "default", Database: "dbscript", Table: "user", Type: "INSERT", After: map[string]any{"id": 4}},
+	)
+
+	if err := p.write(context.Background(), changes); err != nil {
+		t.Fatalf("write() error = %v", err)
+	}
+
+	// two batches before the heartbeat, the retry of id 3 and one after it
+	if expected := []int{2, 1, 1, 1}; !reflect.DeepEqual(sizes, expected) {
+		t.Errorf("batch sizes = %v, expected %v", sizes, expected)
+	}
+
+	var delivered []any
+	for _, e := range sink.events {
+		if payload, ok := e.Payload.(map[string]any); ok && payload["type"] != mysql.HeartbeatEvent {
+			delivered = append(delivered, payload["after"].(map[string]any)["id"])
+			continue
+		}
+		delivered = append(delivered, "heartbeat")
+	}
+
+	if expected := []any{1, 3, "heartbeat", 4}; !reflect.DeepEqual(delivered, expected) {
+		t.Errorf("delivered = %v, expected %v", delivered, expected)
+	}
+}
+
+func TestPipelineBatchFailure(t *testing.T) {
+	calls := 0
+
+	handler := batchHandlerFunc(func(events []event.Event) ([]event.Outcome, error) {
+		calls++
+		if len(events) > 1 {
+			return nil, errors.New("boom")
+		}
+		return []event.Outcome{{Action: event.Ok, Event: events[0]}}, nil
+	})
+
+	sink := &memorySink{}
+	p := New(Options{
+		Handler:    handler,
+		Sink:       sink,
+		Logger:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+		BatchSize:  10,
+		MaxRetries: 1,
+	})
+	p.retryBackoff = 0
+
+	if err := p.write(context.Background(), createTestChanges()); err != nil {
+		t.Fatalf("write() error = %v", err)
+	}
+
+	// the failed batch is retried one event at a time
+	if calls != 3 {
+		t.Errorf("calls = %d, expected 3", calls)
+	}
+
+	if len(sink.events) != 2 {
+		t.Errorf("len(sink.events) = %d, expected 2", len(sink.events))
+	}
+}
+
+type testSavepoint uint64
+
+func (sp testSavepoint) RowBatches() uint64 {
+	return uint64(sp)
+}
+
+func TestPipelineSavepointOrder(t *testing.T) {
+	changes := createTestChanges()
+
+	// the select in run picks between ready streams at random
+	for range 50 {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		p, sink := newTestPipeline(func(e event.Event) (event.Outcome, error) {
+			if e.Payload.(map[string]any)["after"].(map[string]any)["id"] == 2 {
+				cancel()
+			}
+			return event.Outcome{Action: event.Ok, Event: e}, nil
+		}, 0)
+
+		events := make(chan []mysql.RowChangeEvent, 2)
+		savepoints := make(chan testSavepoint, 1)
+
+		// the second batch is queued after the savepoint of the first
+		events <- changes[:1]
+		savepoints <- 1
+		events <- changes[1:]
+
+		var written []int
+		commit := func(sp testSavepoint) error {
+			written = append(written, len(sink.events))
+			return nil
+		}
+
+		if err := run(ctx, p, events, savepoints, commit); !errors.Is(err, context.Canceled) {
+			t.Fatalf("run() error = %v, expected %v", err, context.Canceled)
+		}
+
+		if expected := []int{1}; !reflect.DeepEqual(written, expected) {
+			t.Fatalf("events written at commit = %v, expected %v", written, expected)
+		}
+	}
+}
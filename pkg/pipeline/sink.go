@@ -0,0 +1,118 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/JayJamieson/dbscript/pkg/event"
+)
+
+// WriterSink writes every event as a line of JSON, it is the default sink
+// writing to stdout.
+type WriterSink struct {
+	enc *json.Encoder
+}
+
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{enc: json.NewEncoder(w)}
+}
+
+func (s *WriterSink) Write(events []event.Event) error {
+	for _, e := range events {
+		if err := s.enc.Encode(e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// FileSink appends every event as a line of JSON to a file.
+type FileSink struct {
+	*WriterSink
+	file *os.File
+}
+
+// NewFileSink opens path for appending, creating it when missing.
+func NewFileSink(path string) (*FileSink, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("opening sink %s: %w", path, err)
+	}
+
+	return &FileSink{WriterSink: NewWriterSink(file), file: file}, nil
+}
+
+// Write appends the events and syncs the file so they are durable before the
+// checkpoint advances.
+func (s *FileSink) Write(events []event.Event) error {
+	if err := s.WriterSink.Write(events); err != nil {
+		return err
+	}
+
+	return s.file.Sync()
+}
+
+func (s *FileSink) Close() error {
+	return s.file.Close()
+}
+
+// DefaultWebhookTimeout bounds a webhook request.
+const DefaultWebhookTimeout = 10 * time.Second
+
+// WebhookSink posts every write as a JSON array of events, responses other
+// than 2xx fail the write.
+type WebhookSink struct {
+	url     string
+	headers map[string]string
+	timeout time.Duration
+	client  *http.Client
+}
+
+func NewWebhookSink(url string, headers map[string]string, timeout time.Duration) *WebhookSink {
+	if timeout <= 0 {
+		timeout = DefaultWebhookTimeout
+	}
+
+	return &WebhookSink{url: url, headers: headers, timeout: timeout, client: &http.Client{}}
+}
+
+func (s *WebhookSink) Write(events []event.Event) error {
+	body, err := json.Marshal(events)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range s.headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s responded %s", s.url, resp.Status)
+	}
+
+	return nil
+}
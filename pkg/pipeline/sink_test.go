@@ -0,0 +1,89 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/JayJamieson/dbscript/pkg/event"
+)
+
+func testEvents() []event.Event {
+	return []event.Event{
+		{Metadata: map[string]any{"id": "1"}, Payload: "a", Key: "user:1"},
+		{Metadata: map[string]any{"id": "2"}, Payload: "b"},
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+
+	for range 2 {
+		sink, err := NewFileSink(path)
+		if err != nil {
+			t.Fatalf("NewFileSink() error = %v", err)
+		}
+
+		if err := sink.Write(testEvents()); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+
+		sink.Close()
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// reopening appends
+	if lines := strings.Count(string(data), "\n"); lines != 4 {
+		t.Errorf("lines = %d, expected 4", lines)
+	}
+
+	if first, _, _ := strings.Cut(string(data), "\n"); !strings.Contains(first, `"key":"user:1"`) {
+		t.Errorf("first line = %s, expected the key", first)
+	}
+}
+
+func TestWebhookSink(t *testing.T) {
+	var received []event.Event
+	var token string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		token = r.Header.Get("Authorization")
+		_ = json.NewDecoder(r.Body).Decode(&received)
+	}))
+	defer server.Close()
+
+	headers := map[string]string{"Authorization": "secret"}
+
+	if err := NewWebhookSink(server.URL, headers, 0).Write(testEvents()); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	if len(received) != 2 || received[1].Payload != "b" {
+		t.Fatalf("received = %v, expected both events", received)
+	}
+
+	if received[0].Key != "user:1" || received[1].Key != "" {
+		t.Errorf("keys = %q, %q, expected user:1 and none", received[0].Key, received[1].Key)
+	}
+
+	if token != "secret" {
+		t.Errorf("Authorization = %q, expected secret", token)
+	}
+
+	if err := NewWebhookSink(server.URL+"/fail", nil, 0).Write(testEvents()); err == nil {
+		t.Errorf("Write() expected error for a 500 response")
+	}
+}
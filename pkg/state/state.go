@@ -0,0 +1,429 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/JayJamieson/dbscript/pkg/mysql"
+	gomysql "github.com/go-mysql-org/go-mysql/mysql"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	stateBucket      = []byte("state")
+	checkpointBucket = []byte("checkpoints")
+)
+
+// Store is the key-value state of handlers kept in an embedded database.
+//
+// Writes are visible immediately but only persisted together with the
+// checkpoint of the source whose event made them, in a single transaction.
+// After a restart the state matches the checkpoint, events replayed from it
+// are not applied twice.
+type Store struct {
+	db *bolt.DB
+
+	mu sync.Mutex
+
+	// view is the state including pending writes
+	view map[string]entry
+
+	// pending are the writes not persisted yet by source in the order they
+	// were made. Writes made outside of an event have no source and are
+	// persisted with the next checkpoint of any source.
+	pending map[string][]op
+
+	now func() time.Time
+}
+
+type entry struct {
+	Value json.RawMessage `json:"value"`
+
+	// ExpiresAt is in unix milliseconds, zero never expires
+	ExpiresAt int64 `json:"expires_at,omitempty"`
+}
+
+type opKind int
+
+const (
+	opSet opKind = iota
+	opDelete
+	opIncr
+)
+
+type op struct {
+	kind      opKind
+	key       string
+	value     json.RawMessage
+	by        float64
+	expiresAt int64
+}
+
+// Open opens or creates the state database at path.
+func Open(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("opening state %s: %w", path, err)
+	}
+
+	s := &Store{
+		db:      db,
+		view:    make(map[string]entry),
+		pending: make(map[string][]op),
+		now:     time.Now,
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{stateBucket, checkpointBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+
+		return tx.Bucket(stateBucket).ForEach(func(k, v []byte) error {
+			var e entry
+			if err := json.Unmarshal(v, &e); err != nil {
+				return fmt.Errorf("key %q: %w", k, err)
+			}
+
+			if !s.expired(e) {
+				s.view[string(k)] = e
+			}
+			return nil
+		})
+	})
+
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("loading state %s: %w", path, err)
+	}
+
+	return s, nil
+}
+
+// Close closes the database, pending writes are discarded. Flush first to
+// keep the writes made outside of events.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+func (s *Store) expired(e entry) bool {
+	return e.ExpiresAt != 0 && s.now().UnixMilli() >= e.ExpiresAt
+}
+
+func (s *Store) expiresAt(ttl time.Duration) int64 {
+	if ttl <= 0 {
+		return 0
+	}
+
+	return s.now().Add(ttl).UnixMilli()
+}
+
+// Begin starts the writes of a handler invocation for an event of source.
+// Writes of invocations that are rolled back, for example because they will
+// be retried, are never applied.
+func (s *Store) Begin(source string) *Tx {
+	return &Tx{store: s, source: source, view: make(map[string]*entry)}
+}
+
+// Tx is the state of a single handler invocation, it sees its own writes
+// before they are committed.
+type Tx struct {
+	store  *Store
+	source string
+	ops    []op
+
+	// view holds the entries written by the invocation, nil when deleted
+	view map[string]*entry
+}
+
+func (tx *Tx) current(key string) (entry, bool) {
+	if e, ok := tx.view[key]; ok {
+		if e == nil {
+			return entry{}, false
+		}
+		return *e, true
+	}
+
+	tx.store.mu.Lock()
+	defer tx.store.mu.Unlock()
+
+	e, ok := tx.store.view[key]
+	return e, ok
+}
+
+// Get returns the value of key decoded from JSON, ok is false when the key
+// does not exist or expired.
+func (tx *Tx) Get(key string) (value any, ok bool, err error) {
+	e, ok := tx.current(key)
+	if !ok || tx.store.expired(e) {
+		return nil, false, nil
+	}
+
+	if err := json.Unmarshal(e.Value, &value); err != nil {
+		return nil, false, err
+	}
+
+	return value, true, nil
+}
+
+// Set stores a JSON encodable value, a ttl of zero never expires.
+func (tx *Tx) Set(key string, value any, ttl time.Duration) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("state value for %q is not JSON encodable: %w", key, err)
+	}
+
+	e := entry{Value: data, ExpiresAt: tx.store.expiresAt(ttl)}
+
+	tx.view[key] = &e
+	tx.ops = append(tx.ops, op{kind: opSet, key: key, value: data, expiresAt: e.ExpiresAt})
+
+	return nil
+}
+
+// Delete removes key.
+func (tx *Tx) Delete(key string) {
+	tx.view[key] = nil
+	tx.ops = append(tx.ops, op{kind: opDelete, key: key})
+}
+
+// Incr adds by to the number stored at key, missing keys start at zero. A
+// ttl of zero keeps the current expiry.
+func (tx *Tx) Incr(key string, by float64, ttl time.Duration) (float64, error) {
+	o := op{kind: opIncr, key: key, by: by, expiresAt: tx.store.expiresAt(ttl)}
+
+	current := map[string]entry{}
+	if e, ok := tx.current(key); ok {
+		current[key] = e
+	}
+
+	e, err := tx.store.apply(current, o)
+	if err != nil {
+		return 0, err
+	}
+
+	tx.view[key] = &e
+	tx.ops = append(tx.ops, o)
+
+	var n float64
+	_ = json.Unmarshal(e.Value, &n)
+
+	return n, nil
+}
+
+// Writes returns how many writes the invocation made.
+func (tx *Tx) Writes() int {
+	return len(tx.ops)
+}
+
+// Commit makes the writes visible to other invocations, they are persisted
+// with the next checkpoint of the source.
+func (tx *Tx) Commit() {
+	if len(tx.ops) == 0 {
+		return
+	}
+
+	s := tx.store
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, o := range tx.ops {
+		e, err := s.apply(s.view, o)
+
+		switch {
+		case err != nil:
+			// the value was replaced by another invocation since
+			continue
+		case o.kind == opDelete:
+			delete(s.view, o.key)
+		default:
+			s.view[o.key] = e
+		}
+	}
+
+	s.pending[tx.source] = append(s.pending[tx.source], tx.ops...)
+	tx.ops = nil
+}
+
+// Rollback discards the writes.
+func (tx *Tx) Rollback() {
+	tx.ops = nil
+	clear(tx.view)
+}
+
+// apply returns the entry of o.key after applying o to state.
+func (s *Store) apply(state map[string]entry, o op) (entry, error) {
+	switch o.kind {
+	case opSet:
+		return entry{Value: o.value, ExpiresAt: o.expiresAt}, nil
+	case opDelete:
+		return entry{}, nil
+	}
+
+	current, ok := state[o.key]
+	if !ok || s.expired(current) {
+		current = entry{Value: json.RawMessage("0")}
+	}
+
+	var n float64
+	if err := json.Unmarshal(current.Value, &n); err != nil {
+		return entry{}, fmt.Errorf("state value for %q is not a number", o.key)
+	}
+
+	data, err := json.Marshal(n + o.by)
+	if err != nil {
+		return entry{}, err
+	}
+
+	expiresAt := current.ExpiresAt
+	if o.expiresAt != 0 {
+		expiresAt = o.expiresAt
+	}
+
+	return entry{Value: data, ExpiresAt: expiresAt}, nil
+}
+
+// commit persists the pending writes of source, and writes made outside of
+// an event, together with its checkpoint. The pipeline saves a checkpoint
+// before handling any event sent after it, so the pending writes are exactly
+// those of the events it covers.
+func (s *Store) commit(source string, checkpoint []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ops := append(append([]op(nil), s.pending[""]...), s.pending[source]...)
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		if err := s.persist(tx, ops); err != nil {
+			return err
+		}
+
+		return tx.Bucket(checkpointBucket).Put([]byte(source), checkpoint)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	delete(s.pending, "")
+	delete(s.pending, source)
+
+	return nil
+}
+
+// Flush persists the writes made outside of an event, such as by shutdown
+// hooks, on their own. They are not replayed from any checkpoint, pending
+// writes of events are left for the checkpoint covering them.
+func (s *Store) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ops := s.pending[""]
+	if len(ops) == 0 {
+		return nil
+	}
+
+	if err := s.db.Update(func(tx *bolt.Tx) error { return s.persist(tx, ops) }); err != nil {
+		return err
+	}
+
+	delete(s.pending, "")
+
+	return nil
+}
+
+// persist applies ops to the persisted state.
+func (s *Store) persist(tx *bolt.Tx, ops []op) error {
+	bucket := tx.Bucket(stateBucket)
+
+	// replay the ops against the persisted state so writes of other
+	// sources still pending are left out
+	persisted := make(map[string]entry)
+
+	for _, o := range ops {
+		if _, ok := persisted[o.key]; !ok {
+			if data := bucket.Get([]byte(o.key)); data != nil {
+				var e entry
+				if err := json.Unmarshal(data, &e); err != nil {
+					return err
+				}
+				persisted[o.key] = e
+			}
+		}
+
+		e, err := s.apply(persisted, o)
+		if err != nil {
+			// the value was replaced by a write of another source, keep
+			// the persisted value
+			continue
+		}
+
+		if o.kind == opDelete {
+			delete(persisted, o.key)
+			if err := bucket.Delete([]byte(o.key)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		persisted[o.key] = e
+
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+
+		if err := bucket.Put([]byte(o.key), data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Checkpoint returns the checkpoint store of a source, saving a position
+// persists the state written by the source's events.
+func (s *Store) Checkpoint(source, flavor string) *Checkpoint {
+	return &Checkpoint{store: s, source: source, flavor: flavor}
+}
+
+// Checkpoint implements mysql.CheckpointStore on top of a Store.
+type Checkpoint struct {
+	store  *Store
+	source string
+	flavor string
+}
+
+func (c *Checkpoint) Load() (pos gomysql.Position, gtid gomysql.GTIDSet, ok bool, err error) {
+	var data []byte
+
+	err = c.store.db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(checkpointBucket).Get([]byte(c.source)); v != nil {
+			data = append([]byte(nil), v...)
+		}
+		return nil
+	})
+
+	if err != nil || data == nil {
+		return pos, nil, false, err
+	}
+
+	return mysql.UnmarshalCheckpoint(data, c.flavor)
+}
+
+func (c *Checkpoint) Save(pos gomysql.Position, gtid gomysql.GTIDSet) error {
+	data, err := mysql.MarshalCheckpoint(pos, gtid)
+	if err != nil {
+		return err
+	}
+
+	return c.store.commit(c.source, data)
+}
+
+func (c *Checkpoint) String() string {
+	return fmt.Sprintf("%s in %s", c.source, c.store.db.Path())
+}
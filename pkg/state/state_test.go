@@ -0,0 +1,192 @@
+package state
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	gomysql "github.com/go-mysql-org/go-mysql/mysql"
+)
+
+func openTestStore(t *testing.T, path string) *Store {
+	t.Helper()
+
+	s, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	return s
+}
+
+func get(t *testing.T, s *Store, key string) any {
+	t.Helper()
+
+	value, ok, err := s.Begin("").Get(key)
+	if err != nil {
+		t.Fatalf("Get(%q) error = %v", key, err)
+	}
+	if !ok {
+		return nil
+	}
+
+	return value
+}
+
+func TestStoreTx(t *testing.T) {
+	s := openTestStore(t, filepath.Join(t.TempDir(), "state.db"))
+	defer s.Close()
+
+	tx := s.Begin("a")
+
+	if err := tx.Set("name", "alice", 0); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	if n, err := tx.Incr("count", 2, 0); err != nil || n != 2 {
+		t.Errorf("Incr() = %v, %v, expected 2", n, err)
+	}
+
+	if value, _, _ := tx.Get("name"); value != "alice" {
+		t.Errorf("Get() in tx = %v, expected alice", value)
+	}
+
+	if value := get(t, s, "name"); value != nil {
+		t.Errorf("Get() before commit = %v, expected nil", value)
+	}
+
+	tx.Commit()
+
+	if value := get(t, s, "name"); value != "alice" {
+		t.Errorf("Get() after commit = %v, expected alice", value)
+	}
+
+	rolledBack := s.Begin("a")
+	rolledBack.Delete("name")
+	if _, err := rolledBack.Incr("count", 1, 0); err != nil {
+		t.Fatalf("Incr() error = %v", err)
+	}
+	rolledBack.Rollback()
+
+	if value := get(t, s, "count"); value != float64(2) {
+		t.Errorf("count after rollback = %v, expected 2", value)
+	}
+
+	if value := get(t, s, "name"); value != "alice" {
+		t.Errorf("name after rollback = %v, expected alice", value)
+	}
+
+	tx = s.Begin("a")
+	_ = tx.Set("name", "bob", 0)
+	if _, err := tx.Incr("name", 1, 0); err == nil {
+		t.Errorf("Incr() of a string expected error")
+	}
+}
+
+func TestStoreTTL(t *testing.T) {
+	s := openTestStore(t, filepath.Join(t.TempDir(), "state.db"))
+	defer s.Close()
+
+	now := time.Unix(1000, 0)
+	s.now = func() time.Time { return now }
+
+	tx := s.Begin("")
+	_ = tx.Set("session", "x", time.Minute)
+	_, _ = tx.Incr("hits", 1, time.Minute)
+	tx.Commit()
+
+	now = now.Add(30 * time.Second)
+
+	// incrementing without a ttl keeps the expiry
+	tx = s.Begin("")
+	_, _ = tx.Incr("hits", 1, 0)
+	tx.Commit()
+
+	if value := get(t, s, "hits"); value != float64(2) {
+		t.Errorf("hits = %v, expected 2", value)
+	}
+
+	now = now.Add(time.Minute)
+
+	if value := get(t, s, "session"); value != nil {
+		t.Errorf("session = %v, expected it to expire", value)
+	}
+
+	if n, _ := s.Begin("").Incr("hits", 1, 0); n != 1 {
+		t.Errorf("Incr() of expired key = %v, expected 1", n)
+	}
+}
+
+func TestStorePersistsWithCheckpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.db")
+	s := openTestStore(t, path)
+
+	for _, source := range []string{"a", "b"} {
+		tx := s.Begin(source)
+		_ = tx.Set(source, true, 0)
+		_, _ = tx.Incr("total", 1, 0)
+		tx.Commit()
+	}
+
+	pos := gomysql.Position{Name: "binlog.000001", Pos: 42}
+
+	if err := s.Checkpoint("a", gomysql.MySQLFlavor).Save(pos, nil); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	// writes of b are lost with its checkpoint, it replays its events
+	s.Close()
+	s = openTestStore(t, path)
+	defer s.Close()
+
+	expected := map[string]any{"a": true, "b": nil, "total": float64(1)}
+
+	for key, value := range expected {
+		if got := get(t, s, key); got != value {
+			t.Errorf("Get(%q) after reopen = %v, expected %v", key, got, value)
+		}
+	}
+
+	loaded, _, ok, err := s.Checkpoint("a", gomysql.MySQLFlavor).Load()
+	if err != nil || !ok {
+		t.Fatalf("Load() = %v, %v", ok, err)
+	}
+
+	if loaded != pos {
+		t.Errorf("Load() = %v, expected %v", loaded, pos)
+	}
+
+	if _, _, ok, _ := s.Checkpoint("b", gomysql.MySQLFlavor).Load(); ok {
+		t.Errorf("Load() of b expected no checkpoint")
+	}
+}
+
+func TestStoreFlush(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.db")
+	s := openTestStore(t, path)
+
+	tx := s.Begin("a")
+	_ = tx.Set("event", true, 0)
+	tx.Commit()
+
+	tx = s.Begin("")
+	_, _ = tx.Incr("flushed", 2, 0)
+	tx.Commit()
+
+	if err := s.Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+
+	// writes of events wait for their checkpoint
+	s.Close()
+	s = openTestStore(t, path)
+	defer s.Close()
+
+	expected := map[string]any{"event": nil, "flushed": float64(2)}
+
+	for key, value := range expected {
+		if got := get(t, s, key); got != value {
+			t.Errorf("Get(%q) after reopen = %v, expected %v", key, got, value)
+		}
+	}
+}